@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type nodeStatus struct {
+	Name      string
+	Host      string
+	Port      int
+	AdminPort int
+	Weight    int
+	State     string
+	Healthy   bool
+	Successes int
+	Failures  int
+}
+
+type ringStatus struct {
+	Hash    string
+	Members []string
+}
+
+type lookupStatus struct {
+	Key       string
+	Node      string
+	Fallbacks []string
+}
+
+// startAdmin serves the admin api on addr.
+func startAdmin(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		log.Fatal(http.Serve(l, adminMux()))
+	}()
+	return nil
+}
+
+func adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nodes", listNodes)
+	mux.HandleFunc("/nodes/", nodeAction)
+	mux.HandleFunc("/ring", showRing)
+	mux.HandleFunc("/lookup", lookupKey)
+	mux.HandleFunc("/metrics", showMetrics)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func status(n *node) nodeStatus {
+	return nodeStatus{
+		Name:      n.Name(),
+		Host:      n.Host,
+		Port:      n.Port,
+		AdminPort: n.adminPort(),
+		Weight:    n.weight(),
+		State:     n.state(),
+		Healthy:   n.damp.observed,
+		Successes: n.successes,
+		Failures:  n.failures,
+	}
+}
+
+// listNodes shows every configured node, including the ones out of the ring.
+func listNodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	nodes := allNodes()
+	membership.Lock()
+	list := make([]nodeStatus, len(nodes))
+	for i, n := range nodes {
+		list[i] = status(n)
+	}
+	membership.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, list)
+}
+
+// nodeAction handles POST /nodes/<name>/<drain|disable|enable>.
+func nodeAction(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/nodes/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	name, action := path[:i], path[i+1:]
+	n, found := currentRoutes().nodes[name]
+	if !found {
+		http.Error(w, "unknown node "+name, http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "drain":
+		n.drain()
+	case "disable":
+		n.disable()
+	case "enable":
+		n.enable()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	membership.Lock()
+	s := status(n)
+	membership.Unlock()
+	writeJSON(w, s)
+}
+
+func showRing(w http.ResponseWriter, r *http.Request) {
+	members := append([]string{}, currentRoutes().router.Members()...)
+	sort.Strings(members)
+	writeJSON(w, ringStatus{Hash: hashing, Members: members})
+}
+
+// lookupKey handles GET /lookup?key=<metric>&n=<fallbacks>. The key may be
+// a whole statsd line to route it on its tags.
+func lookupKey(w http.ResponseWriter, r *http.Request) {
+	line := r.FormValue("key")
+	if line == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	fallbacks := 2
+	if v := r.FormValue("n"); v != "" {
+		var err error
+		if fallbacks, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+	}
+
+	k := string(key([]byte(line)))
+	nodes, err := currentRoutes().lookup(k, fallbacks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	res := lookupStatus{Key: k, Node: nodes[0].Name(), Fallbacks: []string{}}
+	for _, n := range nodes[1:] {
+		res.Fallbacks = append(res.Fallbacks, n.Name())
+	}
+	writeJSON(w, res)
+}
+
+// disable takes the node out of the ring until it is enabled, whatever its
+// health checks say.
+func (n *node) disable() {
+	membership.Lock()
+	defer membership.Unlock()
+	log.Println("disabling node", n.Name())
+	n.admin = "disabled"
+	n.remove()
+}
+
+// drain takes the node out of the ring like disable and sends the lines it
+// has already batched.
+func (n *node) drain() {
+	membership.Lock()
+	log.Println("draining node", n.Name())
+	n.admin = "drained"
+	n.remove()
+	membership.Unlock()
+	n.flush()
+}
+
+// enable hands the node back to its health checks, adding it to the ring
+// if it is healthy.
+func (n *node) enable() {
+	membership.Lock()
+	defer membership.Unlock()
+	log.Println("enabling node", n.Name())
+	n.admin = ""
+	if n.damp.observed {
+		n.add()
+	}
+}
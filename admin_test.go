@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal("admin GET should not return an error", err)
+	}
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal("admin should return json", err)
+	}
+}
+
+func TestAdminNodes(t *testing.T) {
+	setupTest(t)
+	server := httptest.NewServer(adminMux())
+	defer server.Close()
+
+	var nodes []nodeStatus
+	getJSON(t, server.URL+"/nodes", &nodes)
+	if len(nodes) < 3 || nodes[0].Name != "127.0.0.1:8127" || nodes[0].State != "up" {
+		t.Error("expected the configured nodes to be listed as up, but they were", nodes)
+	}
+
+	var ring ringStatus
+	getJSON(t, server.URL+"/ring", &ring)
+	if len(ring.Members) != 3 || ring.Hash != "ring" {
+		t.Error("expected 3 ring members, but the ring was", ring)
+	}
+
+	var l lookupStatus
+	getJSON(t, server.URL+"/lookup?key=statsd.metric.test", &l)
+	if l.Node != "127.0.0.1:8129" || len(l.Fallbacks) != 2 {
+		t.Error("expected statsd.metric.test to be owned by 127.0.0.1:8129, but the lookup was", l)
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	setupTest(t)
+	server := httptest.NewServer(adminMux())
+	defer server.Close()
+
+	for _, action := range []string{"disable", "drain"} {
+		res, err := http.Post(server.URL+"/nodes/127.0.0.1:8131/"+action, "", nil)
+		if err != nil {
+			t.Fatal("admin POST should not return an error", err)
+		}
+		var s nodeStatus
+		json.NewDecoder(res.Body).Decode(&s)
+		res.Body.Close()
+		if s.State == "up" || inRing("127.0.0.1:8131") {
+			t.Error("expected", action, "to take the node out of the ring, but it was", s.State)
+		}
+	}
+
+	res, err := http.Post(server.URL+"/nodes/127.0.0.1:8131/enable", "", nil)
+	if err != nil {
+		t.Fatal("admin POST should not return an error", err)
+	}
+	res.Body.Close()
+	if !inRing("127.0.0.1:8131") {
+		t.Error("expected enable to put the healthy node back in the ring")
+	}
+
+	res, _ = http.Get(server.URL + "/nodes/127.0.0.1:8131/disable")
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Error("expected actions to need a POST, but the status was", res.StatusCode)
+	}
+	res, _ = http.Post(server.URL+"/nodes/127.0.0.1:9999/disable", "", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Error("expected an unknown node to be not found, but the status was", res.StatusCode)
+	}
+}
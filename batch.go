@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type batchConfig struct {
+	Size     int
+	Interval duration
+}
+
+// batching is enabled when a flush interval is configured.
+var batching batchConfig
+
+// datagramSize is the largest datagram that fits in a single ethernet frame.
+const datagramSize = 1432
+
+func (b *batchConfig) setDefaults() {
+	if b.Size == 0 {
+		b.Size = datagramSize
+	}
+}
+
+// batch joins the lines for one node into datagrams of up to size bytes.
+type batch struct {
+	sync.Mutex
+	size int
+	addr *net.UDPAddr
+	conn *net.UDPConn
+	buf  []byte
+}
+
+func newBatch(size int, addr *net.UDPAddr) *batch {
+	return &batch{size: size, addr: addr, buf: make([]byte, 0, size)}
+}
+
+func (b *batch) write(conn *net.UDPConn, line []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	b.conn = conn
+
+	var err error
+	if len(b.buf) > 0 && len(b.buf)+1+len(line) > b.size {
+		err = b.flush()
+	}
+	if len(b.buf) > 0 {
+		b.buf = append(b.buf, '\n')
+	}
+	b.buf = append(b.buf, line...)
+	if len(b.buf) >= b.size {
+		if ferr := b.flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func (b *batch) Flush() error {
+	b.Lock()
+	defer b.Unlock()
+	return b.flush()
+}
+
+func (b *batch) flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	_, err := b.conn.WriteToUDP(b.buf, b.addr)
+	b.buf = b.buf[:0]
+	return err
+}
+
+// send writes the line to the node, through its stream when it is reached
+// over tcp or tls and its batch when batching is on.
+func (n *node) send(conn *net.UDPConn, line []byte) error {
+	if n.stream != nil {
+		n.stream.write(line)
+		return nil
+	}
+	if n.batch == nil {
+		_, err := conn.WriteToUDP(line, &n.Addr)
+		return err
+	}
+	return n.batch.write(conn, line)
+}
+
+// flush sends the lines held for the node.
+func (n *node) flush() {
+	switch {
+	case n.stream != nil:
+		// the stream counts its own failures
+		n.stream.Flush()
+	case n.batch != nil:
+		if err := n.batch.Flush(); err != nil {
+			n.writeFailed()
+		}
+	}
+}
+
+// flushAll sends every partially filled batch and waits for the buffered
+// streams to be written.
+func flushAll() {
+	for _, n := range allNodes() {
+		n.flush()
+	}
+}
+
+// flushBatches sends partially filled batches on every interval. Streams
+// write as soon as they have lines, so they are left alone.
+func flushBatches(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, n := range allNodes() {
+			if n.batch != nil {
+				n.flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func readDatagram(conn *net.UDPConn, t *testing.T) string {
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	b := make([]byte, 2048)
+	n, _, err := conn.ReadFromUDP(b)
+	if err != nil {
+		t.Error("server Read should not return an error", err)
+	}
+	return string(b[:n])
+}
+
+func TestBatch(t *testing.T) {
+	server, err := makeConn("udp4", 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to setup the server", err)
+	}
+	defer server.Close()
+	client, err := makeConn("udp4", 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to setup the client", err)
+	}
+	defer client.Close()
+
+	b := newBatch(30, server.LocalAddr().(*net.UDPAddr))
+	b.write(client, []byte("statsd.a:1|c"))
+	b.write(client, []byte("statsd.b:2|c"))
+	b.write(client, []byte("statsd.c:3|c"))
+	if cmd := readDatagram(server, t); cmd != "statsd.a:1|c\nstatsd.b:2|c" {
+		t.Error("expected a full batch to be sent when the next line does not fit, but received", cmd)
+	}
+
+	b.Flush()
+	if cmd := readDatagram(server, t); cmd != "statsd.c:3|c" {
+		t.Error("expected Flush to send the remaining line, but received", cmd)
+	}
+
+	b.write(client, []byte("statsd.a.very.long.metric.name:1|c"))
+	if cmd := readDatagram(server, t); cmd != "statsd.a.very.long.metric.name:1|c" {
+		t.Error("expected a line larger than the batch to be sent on its own, but received", cmd)
+	}
+}
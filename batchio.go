@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+)
+
+// readBatches reads up to size datagrams per recvmmsg call.
+func readBatches(conn *net.UDPConn, w *workers, size int) error {
+	pc := ipv4.NewPacketConn(conn)
+	msgs := make([]ipv4.Message, size)
+	packets := make([]*packet, size)
+	for {
+		for i := range msgs {
+			if packets[i] == nil {
+				packets[i] = w.get()
+				msgs[i].Buffers = [][]byte{packets[i].Buffer}
+			}
+		}
+
+		count, err := pc.ReadBatch(msgs, 0)
+		if err != nil {
+			for i, p := range packets {
+				w.put(p)
+				packets[i] = nil
+			}
+			return err
+		}
+		for i := 0; i < count; i++ {
+			p := packets[i]
+			p.Length = msgs[i].N
+			received(p, msgs[i].Addr)
+			w.queue(p)
+			packets[i] = nil
+		}
+	}
+}
+
+// mmsgWriter collects the datagrams for one packet and sends them with a
+// single sendmmsg call.
+type mmsgWriter struct {
+	pc    *ipv4.PacketConn
+	msgs  []ipv4.Message
+	nodes []*node
+}
+
+func newMmsgWriter(conn *net.UDPConn, size int) *mmsgWriter {
+	return &mmsgWriter{
+		pc:    ipv4.NewPacketConn(conn),
+		msgs:  make([]ipv4.Message, 0, size),
+		nodes: make([]*node, 0, size),
+	}
+}
+
+func (m *mmsgWriter) add(n *node, line []byte) {
+	if len(m.msgs) == cap(m.msgs) {
+		m.flush()
+	}
+	m.msgs = append(m.msgs, ipv4.Message{Buffers: [][]byte{line}, Addr: &n.Addr})
+	m.nodes = append(m.nodes, n)
+}
+
+// flush sends the collected datagrams. A datagram that fails to send marks
+// its node down and the rest are still sent.
+func (m *mmsgWriter) flush() {
+	for sent := 0; sent < len(m.msgs); {
+		count, err := m.pc.WriteBatch(m.msgs[sent:], 0)
+		// sendmmsg returns -1 when the first datagram fails
+		if count > 0 {
+			sent += count
+		}
+		if err == nil && count <= 0 {
+			break
+		}
+		if err != nil {
+			if sent < len(m.nodes) {
+				m.nodes[sent].writeFailed()
+			}
+			sent++
+		}
+	}
+	for i := range m.msgs {
+		m.msgs[i] = ipv4.Message{}
+		m.nodes[i] = nil
+	}
+	m.msgs = m.msgs[:0]
+	m.nodes = m.nodes[:0]
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+func TestBatchIO(t *testing.T) {
+	setupTest(t)
+	bc := c
+	bc.Port = 0
+	bc.IOBatch = 8
+	conn, err := makeConn(bc.UdpVersion, bc.Port, bc.Host)
+	if err != nil {
+		t.Fatal("should be able to start the proxy", err)
+	}
+	defer conn.Close()
+	go read(conn, newWorkers(conn, &bc), &bc)
+
+	client, _ := newConn(t)
+	addr := makeAddr(conn.LocalAddr().(*net.UDPAddr).Port, "127.0.0.1")
+	_, err = client.WriteTo([]byte("statsd.metric.test:1|c\nstatsd.metric.name:2|g"), &addr)
+	if err != nil {
+		t.Error("conn Write should not return an error", err)
+	}
+
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+	readMetric("127.0.0.1:8127", "statsd.metric.name:2|g", t)
+}
+
+func TestBatchIOWriteError(t *testing.T) {
+	setupTest(t)
+	conn, err := makeConn(c.UdpVersion, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to create a connection", err)
+	}
+	defer conn.Close()
+
+	// a datagram larger than udp allows fails with EMSGSIZE
+	bad := &node{Host: "127.0.0.1", Port: 9200}
+	bad.Addr = makeAddr(bad.Port, bad.Host)
+	good := &node{Host: "127.0.0.1", Port: 8127}
+	good.Addr = makeAddr(good.Port, good.Host)
+
+	out := newMmsgWriter(conn, 4)
+	out.add(bad, bytes.Repeat([]byte("a"), 70000))
+	out.add(good, []byte("statsd.metric.name:4|g"))
+	out.flush()
+
+	if bad.writeErrors.Value() != 1 {
+		t.Error("expected the failed datagram to be counted, but there were", bad.writeErrors.Value(), "errors")
+	}
+	readMetric("127.0.0.1:8127", "statsd.metric.name:4|g", t)
+}
+
+var benchLines = bytes.Repeat([]byte("statsd.metric.test:1|c\nstatsd.metric.name:2|g\n"), 10)
+
+func benchmarkHandle(b *testing.B, ioBatch int) {
+	setupTest(b)
+	conn, err := makeConn(c.UdpVersion, 0, "127.0.0.1")
+	if err != nil {
+		b.Fatal("should be able to create a connection", err)
+	}
+	defer conn.Close()
+
+	var out *mmsgWriter
+	if ioBatch > 0 {
+		out = newMmsgWriter(conn, ioBatch)
+	}
+	p := packet{Length: len(benchLines), Buffer: benchLines}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.handle(conn, out)
+	}
+}
+
+func BenchmarkHandle(b *testing.B) {
+	benchmarkHandle(b, 0)
+}
+
+func BenchmarkHandleBatchIO(b *testing.B) {
+	benchmarkHandle(b, 32)
+}
+
+// benchmarkRead reads b.N datagrams while another goroutine keeps sending.
+func benchmarkRead(b *testing.B, read func(conn *net.UDPConn) int) {
+	conn, err := makeConn("udp4", 0, "127.0.0.1")
+	if err != nil {
+		b.Fatal("should be able to create a connection", err)
+	}
+	defer conn.Close()
+	client, err := makeConn("udp4", 0, "127.0.0.1")
+	if err != nil {
+		b.Fatal("should be able to create a connection", err)
+	}
+	defer client.Close()
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		addr := conn.LocalAddr().(*net.UDPAddr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				client.WriteToUDP([]byte("statsd.metric.test:1|c"), addr)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; {
+		n += read(conn)
+	}
+}
+
+func BenchmarkReadFromUDP(b *testing.B) {
+	buf := make([]byte, 1024)
+	benchmarkRead(b, func(conn *net.UDPConn) int {
+		conn.ReadFromUDP(buf)
+		return 1
+	})
+}
+
+func BenchmarkReadBatch(b *testing.B) {
+	var pc *ipv4.PacketConn
+	msgs := make([]ipv4.Message, 32)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, 1024)}
+	}
+	benchmarkRead(b, func(conn *net.UDPConn) int {
+		if pc == nil {
+			pc = ipv4.NewPacketConn(conn)
+		}
+		n, _ := pc.ReadBatch(msgs, 0)
+		return n
+	})
+}
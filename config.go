@@ -2,14 +2,63 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"time"
 )
 
 type config struct {
-	Nodes      []node
-	Host       string
-	Port       int
-	UdpVersion string
+	Nodes        []node
+	Replicas     int
+	Hash         string
+	HashKey      string
+	HashTags     []string
+	Host         string
+	Port         int
+	UdpVersion   string
+	ReadBuffer   int
+	Readers      int
+	Workers      int
+	QueueSize    int
+	Overflow     string
+	IOBatch      int
+	Invalid      string
+	Quarantine   string
+	DrainTimeout duration
+	Admin        string
+	TCP          tcpConfig
+	Unix         unixConfig
+	SelfStats    selfStatsConfig
+	Events       eventsConfig
+	Health       healthConfig
+	Damping      dampingConfig
+	Batch        batchConfig
+	Stream       streamConfig
+}
+
+// duration is a time.Duration that reads from json strings like "10s".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
 }
 
 func (c *config) read(env string) error {
@@ -17,5 +66,121 @@ func (c *config) read(env string) error {
 	if err != nil {
 		return err
 	}
-	return json.NewDecoder(file).Decode(&c)
+	defer file.Close()
+	return c.decode(file)
+}
+
+// decode reads the config from r, filling in defaults and checking values.
+func (c *config) decode(r io.Reader) error {
+	err := json.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return err
+	}
+	if c.Hash == "" {
+		c.Hash = "ring"
+	}
+	if _, found := routers[c.Hash]; !found {
+		return fmt.Errorf("unknown hash %q", c.Hash)
+	}
+	switch c.HashKey {
+	case "":
+		c.HashKey = "name"
+	case "name", "all_tags":
+	case "tags":
+		if len(c.HashTags) == 0 {
+			return errors.New("hashing on selected tags needs a list of HashTags")
+		}
+	default:
+		return fmt.Errorf("unknown hash key %q", c.HashKey)
+	}
+	switch c.Events.Route {
+	case "":
+		c.Events.Route = "hash"
+	case "hash", "all":
+	case "node":
+		if c.Events.Node == "" {
+			return errors.New("routing events to a node needs the host:port of an Events Node")
+		}
+		if !c.hasNode(c.Events.Node) {
+			return fmt.Errorf("events node %s is not one of the Nodes", c.Events.Node)
+		}
+	default:
+		return fmt.Errorf("unknown event route %q", c.Events.Route)
+	}
+	for _, n := range c.Nodes {
+		switch n.Protocol {
+		case "", "udp", "tcp", "tls":
+		default:
+			return fmt.Errorf("unknown protocol %q for node %s", n.Protocol, n.Name())
+		}
+	}
+	if c.Hash == "proxyjs" {
+		for i := range c.Nodes {
+			if w := c.Nodes[i].Weight; w != 0 && w != 1 {
+				return fmt.Errorf("node %s has a Weight of %d, which proxy.js cannot match", c.Nodes[i].Name(), w)
+			}
+		}
+	}
+	if c.Replicas == 0 {
+		c.Replicas = 1
+	}
+	if c.ReadBuffer == 0 {
+		c.ReadBuffer = 8192
+	}
+	if c.DrainTimeout.Duration == 0 {
+		c.DrainTimeout.Duration = 5 * time.Second
+	}
+	if c.Readers == 0 {
+		c.Readers = 1
+	}
+	if c.Workers == 0 {
+		c.Workers = runtime.NumCPU()
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 1024
+	}
+	switch c.Overflow {
+	case "":
+		c.Overflow = "drop"
+	case "drop", "block":
+	default:
+		return fmt.Errorf("unknown overflow policy %q", c.Overflow)
+	}
+	switch c.Invalid {
+	case "":
+		c.Invalid = "pass"
+	case "pass", "drop":
+	case "quarantine":
+		if c.Quarantine == "" {
+			return errors.New("quarantining invalid lines needs a Quarantine file")
+		}
+	default:
+		return fmt.Errorf("unknown invalid line mode %q", c.Invalid)
+	}
+	c.TCP.setDefaults(c.ReadBuffer)
+	if c.TCP.MaxLineLength > c.ReadBuffer {
+		return fmt.Errorf("the TCP MaxLineLength of %d bytes is longer than the %d byte ReadBuffer", c.TCP.MaxLineLength, c.ReadBuffer)
+	}
+	c.Unix.setDefaults()
+	if _, err = c.Unix.mode(); err != nil {
+		return err
+	}
+	c.Health.setDefaults()
+	c.Damping.setDefaults()
+	c.Batch.setDefaults()
+	c.Stream.setDefaults()
+	if err = c.Stream.load(); err != nil {
+		return err
+	}
+	c.SelfStats.setDefaults()
+	return nil
+}
+
+func (c *config) hasNode(name string) bool {
+	for i := range c.Nodes {
+		if c.Nodes[i].Name() == name {
+			return true
+		}
+	}
+	return false
 }
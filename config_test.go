@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// decodeConfig reads a config from json the way the proxy reads its file.
+func decodeConfig(conf string) error {
+	var c config
+	return c.decode(strings.NewReader(conf))
+}
+
+func TestConfigChecks(t *testing.T) {
+	for _, test := range []struct {
+		conf  string
+		valid bool
+	}{
+		{`{"Nodes": [{"Host": "127.0.0.1", "Port": 8127}], "Events": {"Route": "node", "Node": "127.0.0.1:8127"}}`, true},
+		{`{"Nodes": [{"Host": "127.0.0.1", "Port": 8127}], "Events": {"Route": "node", "Node": "127.0.0.1:8172"}}`, false},
+		{`{"Hash": "proxyjs", "Nodes": [{"Host": "127.0.0.1", "Port": 8127}]}`, true},
+		{`{"Hash": "proxyjs", "Nodes": [{"Host": "127.0.0.1", "Port": 8127, "Weight": 1}]}`, true},
+		{`{"Hash": "proxyjs", "Nodes": [{"Host": "127.0.0.1", "Port": 8127, "Weight": 2}]}`, false},
+	} {
+		if err := decodeConfig(test.conf); (err == nil) != test.valid {
+			t.Error("expected", test.conf, "to be valid:", test.valid, "but got", err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// dampingConfig holds a node in or out of the ring until it is stable. Each
+// mechanism is disabled while its fields are zero.
+type dampingConfig struct {
+	Hold     duration
+	Penalty  float64
+	HalfLife duration
+	Suppress float64
+	Reuse    float64
+	MaxFlaps int
+	Window   duration
+}
+
+var damping dampingConfig
+
+func (d *dampingConfig) setDefaults() {
+	if d.Penalty == 0 {
+		return
+	}
+	if d.HalfLife.Duration == 0 {
+		d.HalfLife.Duration = 15 * time.Second
+	}
+	if d.Suppress == 0 {
+		d.Suppress = 2 * d.Penalty
+	}
+	if d.Reuse == 0 {
+		d.Reuse = d.Suppress / 2
+	}
+}
+
+func (d *dampingConfig) enabled() bool {
+	return d.Hold.Duration > 0 || d.Penalty > 0 || d.MaxFlaps > 0
+}
+
+// damper tracks the observed state of a node and how often it has flapped.
+type damper struct {
+	observed   bool
+	changed    time.Time
+	penalty    float64
+	decayed    time.Time
+	suppressed bool
+	flaps      []time.Time
+}
+
+func (d *damper) decay(now time.Time, c dampingConfig) {
+	if d.penalty > 0 && c.HalfLife.Duration > 0 {
+		halves := float64(now.Sub(d.decayed)) / float64(c.HalfLife.Duration)
+		d.penalty *= math.Pow(0.5, halves)
+	}
+	d.decayed = now
+}
+
+func (d *damper) observe(up bool, now time.Time, c dampingConfig) {
+	if up == d.observed {
+		return
+	}
+	d.observed = up
+	d.decay(now, c)
+	d.penalty += c.Penalty
+	d.flaps = append(d.flaps, now)
+}
+
+// want is the ring membership the node should have right now.
+func (d *damper) want(now time.Time, c dampingConfig) bool {
+	d.decay(now, c)
+	if c.Penalty > 0 {
+		if d.penalty >= c.Suppress {
+			d.suppressed = true
+		} else if d.penalty < c.Reuse {
+			d.suppressed = false
+		}
+	}
+
+	if c.MaxFlaps > 0 {
+		i := 0
+		for i < len(d.flaps) && now.Sub(d.flaps[i]) > c.Window.Duration {
+			i++
+		}
+		d.flaps = d.flaps[i:]
+	} else {
+		d.flaps = d.flaps[:0]
+	}
+
+	return d.observed && !d.suppressed && (c.MaxFlaps == 0 || len(d.flaps) <= c.MaxFlaps)
+}
+
+// observe records the state a health check or write saw and changes the
+// ring if the damping rules allow it.
+func (n *node) observe(up bool) {
+	membership.Lock()
+	defer membership.Unlock()
+	now := time.Now()
+	n.damp.observe(up, now, damping)
+	n.settle(now)
+}
+
+func (n *node) observed() bool {
+	membership.Lock()
+	defer membership.Unlock()
+	return n.damp.observed
+}
+
+func (n *node) settle(now time.Time) {
+	want := n.damp.want(now, damping) && n.admin == ""
+	if want == n.up {
+		return
+	}
+	if now.Sub(n.damp.changed) < damping.Hold.Duration {
+		return
+	}
+	if want {
+		n.add()
+	} else {
+		if n.damp.observed && n.admin == "" {
+			log.Println("node", n.Name(), "is flapping, holding it down")
+		}
+		n.remove()
+	}
+	n.damp.changed = now
+}
+
+// settleNodes applies changes that were held back once they become stable.
+func settleNodes() {
+	for now := range time.Tick(time.Second) {
+		nodes := allNodes()
+		membership.Lock()
+		for _, n := range nodes {
+			n.settle(now)
+		}
+		membership.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDamperPenalty(t *testing.T) {
+	c := dampingConfig{Penalty: 1000}
+	c.HalfLife.Duration = 10 * time.Second
+	c.setDefaults()
+	now := time.Now()
+	d := damper{observed: true, decayed: now}
+
+	d.observe(false, now, c)
+	d.observe(true, now, c)
+	if d.want(now, c) {
+		t.Error("node should be suppressed after flapping twice, penalty was", d.penalty)
+	}
+
+	now = now.Add(10 * time.Second)
+	if d.want(now, c) {
+		t.Error("node should stay suppressed until the penalty decays below reuse, penalty was", d.penalty)
+	}
+
+	now = now.Add(10 * time.Second)
+	if !d.want(now, c) {
+		t.Error("node should be reused once the penalty decays, penalty was", d.penalty)
+	}
+}
+
+func TestDamperMaxFlaps(t *testing.T) {
+	c := dampingConfig{MaxFlaps: 2}
+	c.Window.Duration = time.Minute
+	now := time.Now()
+	d := damper{observed: true}
+
+	d.observe(false, now, c)
+	d.observe(true, now, c)
+	if !d.want(now, c) {
+		t.Error("node should be allowed", c.MaxFlaps, "flaps")
+	}
+	d.observe(false, now, c)
+	d.observe(true, now, c)
+	if d.want(now, c) {
+		t.Error("node should be held down after", len(d.flaps), "flaps")
+	}
+	if !d.want(now.Add(2*time.Minute), c) {
+		t.Error("node should come back once the flaps leave the window")
+	}
+}
+
+func TestSettleHold(t *testing.T) {
+	saved := damping
+	defer func() { damping = saved }()
+	damping = dampingConfig{}
+	damping.Hold.Duration = time.Minute
+
+	n := node{Host: "127.0.0.1", Port: 9002}
+	insert(&n)
+	defer n.Remove()
+
+	now := time.Now()
+	membership.Lock()
+	n.damp.changed = now
+	n.damp.observe(false, now, damping)
+	n.settle(now.Add(time.Second))
+	held := n.up
+	n.settle(now.Add(2 * time.Minute))
+	membership.Unlock()
+
+	if !held {
+		t.Error("node should stay in the ring during the hold time")
+	}
+	if n.isUp() {
+		t.Error("node should be removed once the hold time has passed")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// eventsConfig routes DogStatsD events and service checks, which have no
+// metric name: hashed on the event title or check name, sent to one Node, or
+// sent to all the nodes in the ring.
+type eventsConfig struct {
+	Route string
+	Node  string
+}
+
+var events = eventsConfig{Route: "hash"}
+
+var (
+	eventPrefix = []byte("_e{")
+	checkPrefix = []byte("_sc|")
+)
+
+func isEvent(line []byte) bool {
+	return bytes.HasPrefix(line, eventPrefix) || bytes.HasPrefix(line, checkPrefix)
+}
+
+// eventKey returns the title of an event, _e{title.length,text.length}:title|text,
+// or the name of a service check, _sc|name|status.
+func eventKey(line []byte) ([]byte, error) {
+	if bytes.HasPrefix(line, checkPrefix) {
+		fields := bytes.SplitN(line[len(checkPrefix):], []byte{'|'}, 3)
+		if len(fields) < 2 || len(fields[0]) == 0 {
+			return nil, errMalformed
+		}
+		if status, err := strconv.Atoi(string(fields[1])); err != nil || status < 0 || status > 3 {
+			return nil, errMalformed
+		}
+		return fields[0], nil
+	}
+
+	rest := line[len(eventPrefix):]
+	end := bytes.IndexByte(rest, '}')
+	if end < 0 {
+		return nil, errMalformed
+	}
+	lengths := bytes.SplitN(rest[:end], []byte{','}, 2)
+	if len(lengths) != 2 {
+		return nil, errMalformed
+	}
+	titleLen, err := strconv.Atoi(string(lengths[0]))
+	if err != nil || titleLen <= 0 {
+		return nil, errMalformed
+	}
+	textLen, err := strconv.Atoi(string(lengths[1]))
+	if err != nil || textLen < 0 {
+		return nil, errMalformed
+	}
+
+	rest = rest[end+1:]
+	if len(rest) < 1+titleLen+1+textLen || rest[0] != ':' || rest[1+titleLen] != '|' {
+		return nil, errMalformed
+	}
+	return rest[1 : 1+titleLen], nil
+}
+
+// route finds the nodes an event or service check is sent to.
+func (e eventsConfig) route(r *routes, line []byte) ([]*node, error) {
+	key, err := eventKey(line)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Route {
+	case "node":
+		n, found := r.nodes[e.Node]
+		if !found {
+			return nil, errUnknownNode
+		}
+		return []*node{n}, nil
+	case "all":
+		var nodes []*node
+		for _, n := range r.members {
+			if !containsNode(nodes, n) {
+				nodes = append(nodes, n)
+			}
+		}
+		if len(nodes) == 0 {
+			return nil, errNoBackend
+		}
+		return nodes, nil
+	}
+
+	n, err := r.route(key)
+	if err != nil {
+		return nil, err
+	}
+	return []*node{n}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestEventKey(t *testing.T) {
+	for line, want := range map[string]string{
+		"_e{5,4}:title|text":                            "title",
+		"_e{9,10}:deploy|ok|line\\ntwo|p:low|#env:prod": "deploy|ok",
+		"_e{5,0}:title|":                                "title",
+		"_sc|db.up|0|#env:prod|m:fine":                  "db.up",
+	} {
+		key, err := eventKey([]byte(line))
+		if err != nil || string(key) != want {
+			t.Error("expected the key of", line, "to be", want, "but it was", string(key), err)
+		}
+	}
+
+	for _, line := range []string{
+		"_e{5,4}:tit|text",
+		"_e{x,4}:title|text",
+		"_e{5,40}:title|text",
+		"_e{5:title|text",
+		"_sc|db.up|7",
+		"_sc||0",
+		"_sc|db.up",
+	} {
+		if _, err := eventKey([]byte(line)); err != errMalformed {
+			t.Error("expected", line, "to be malformed, but got", err)
+		}
+	}
+}
+
+func TestRouteEvent(t *testing.T) {
+	nodes := map[string]*node{}
+	for i, weight := range []int{2, 1, 1} {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, Weight: weight, up: true}
+		nodes[n.Name()] = n
+	}
+	nodes["127.0.0.1:9102"].up = false
+	r := newRoutes(nodes)
+	line := []byte("_e{6,2}:deploy|ok")
+
+	e := eventsConfig{Route: "hash"}
+	got, err := e.route(r, line)
+	want, _ := r.route([]byte("deploy"))
+	if err != nil || len(got) != 1 || got[0] != want {
+		t.Error("expected the event to go to the owner of its title", want.Name(), "but got", got, err)
+	}
+
+	e = eventsConfig{Route: "node", Node: "127.0.0.1:9101"}
+	got, err = e.route(r, line)
+	if err != nil || len(got) != 1 || got[0].Name() != "127.0.0.1:9101" {
+		t.Error("expected the event to go to the configured node, but got", got, err)
+	}
+	e.Node = "127.0.0.1:9999"
+	if _, err = e.route(r, line); err != errUnknownNode {
+		t.Error("expected an unknown events node to be an error, but got", err)
+	}
+
+	e = eventsConfig{Route: "all"}
+	got, err = e.route(r, line)
+	if err != nil || len(got) != 2 {
+		t.Error("expected the event to go once to each node in the ring, but got", got, err)
+	}
+}
+
+func TestForwardEvent(t *testing.T) {
+	setupTest(t)
+	line := "_sc|statsd.metric.test|0|#env:prod"
+	n, err := currentRoutes().route([]byte("statsd.metric.test"))
+	if err != nil {
+		t.Fatal("expected the service check name to route", err)
+	}
+	conn, addr := newConn(t)
+	if _, err = conn.WriteTo([]byte(line), &addr); err != nil {
+		t.Error("conn Write should not return an error", err)
+	}
+
+	readMetric(n.Name(), line, t)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// hashKey decides which part of a line picks its node: the name alone, the
+// name with the tags in hashTags, or the name with all of its tags.
+var (
+	hashKey  = "name"
+	hashTags map[string]bool
+)
+
+func setHashKey(kind string, tags []string) {
+	hashKey = kind
+	hashTags = make(map[string]bool, len(tags))
+	for _, t := range tags {
+		hashTags[t] = true
+	}
+}
+
+// hashKey returns the bytes the line is routed on. Tags are sorted so the
+// same series always lands on the same node whatever order the client sent
+// them in, and a line without matching tags routes on its name alone.
+func (m *metric) hashKey() []byte {
+	if hashKey == "name" || len(m.Tags) == 0 {
+		return m.Name
+	}
+
+	var tags [][]byte
+	for _, t := range bytes.Split(m.Tags, []byte{','}) {
+		t = bytes.TrimSpace(t)
+		if len(t) == 0 {
+			continue
+		}
+		if hashKey == "tags" {
+			name := t
+			if i := bytes.IndexByte(t, ':'); i >= 0 {
+				name = t[:i]
+			}
+			if !hashTags[string(name)] {
+				continue
+			}
+		}
+		tags = append(tags, t)
+	}
+	if len(tags) == 0 {
+		return m.Name
+	}
+	sort.Slice(tags, func(i, j int) bool { return bytes.Compare(tags[i], tags[j]) < 0 })
+
+	key := append([]byte{}, m.Name...)
+	key = append(key, "|#"...)
+	for i, t := range tags {
+		if i > 0 && bytes.Equal(t, tags[i-1]) {
+			continue
+		}
+		if i > 0 {
+			key = append(key, ',')
+		}
+		key = append(key, t...)
+	}
+	return key
+}
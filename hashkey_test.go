@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func hashKeyOf(t *testing.T, line string) string {
+	m, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatal("expected", line, "to be valid", err)
+	}
+	return string(m.hashKey())
+}
+
+func TestHashKey(t *testing.T) {
+	defer setHashKey("name", nil)
+
+	line := "api.latency:12|ms|#host:a,env:prod,region:us"
+	setHashKey("name", nil)
+	if k := hashKeyOf(t, line); k != "api.latency" {
+		t.Error("expected to hash on the name alone, but the key was", k)
+	}
+
+	setHashKey("all_tags", nil)
+	if k := hashKeyOf(t, line); k != "api.latency|#env:prod,host:a,region:us" {
+		t.Error("expected to hash on the name and the sorted tags, but the key was", k)
+	}
+	if k := hashKeyOf(t, "api.latency:12|ms|#region:us, env:prod,host:a,env:prod"); k != "api.latency|#env:prod,host:a,region:us" {
+		t.Error("expected the tags to be put in canonical order, but the key was", k)
+	}
+
+	setHashKey("tags", []string{"env", "region"})
+	if k := hashKeyOf(t, line); k != "api.latency|#env:prod,region:us" {
+		t.Error("expected to hash on the name and the selected tags, but the key was", k)
+	}
+	if k := hashKeyOf(t, "api.latency:12|ms|#host:a"); k != "api.latency" {
+		t.Error("expected a line without selected tags to hash on its name, but the key was", k)
+	}
+}
+
+func TestKey(t *testing.T) {
+	defer setHashKey("name", nil)
+
+	setHashKey("tags", []string{"env"})
+	for line, want := range map[string]string{
+		"api.latency":                         "api.latency",
+		" api.latency:12|ms|#env:prod,host:a": "api.latency|#env:prod",
+		"api.latency:12|ms":                   "api.latency",
+	} {
+		if k := string(key([]byte(line))); k != want {
+			t.Error("expected lookup and plan to route", line, "on", want, "like the proxy, but the key was", k)
+		}
+	}
+}
+
+func TestParseDogStatsD(t *testing.T) {
+	m, err := parseLine([]byte("api.latency:12:15:9|d|#env:prod|c:abc123|T1656581400"))
+	if err != nil {
+		t.Fatal("expected the DogStatsD line to be valid", err)
+	}
+	if string(m.Value) != "12:15:9" || string(m.Container) != "abc123" || string(m.Timestamp) != "1656581400" {
+		t.Error("expected the values, container and timestamp to be parsed, but they were", string(m.Value), string(m.Container), string(m.Timestamp))
+	}
+	if _, err = parseLine([]byte("api.latency:12:x|d")); err != errBadValue {
+		t.Error("expected every value to be a number, but it returned", err)
+	}
+	if _, err = parseLine([]byte("api.latency:12|d|Tnow")); err != errBadField {
+		t.Error("expected the timestamp to be a number, but it returned", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type healthConfig struct {
+	Interval duration
+	Timeout  duration
+	Rise     int
+	Fall     int
+}
+
+func (h *healthConfig) setDefaults() {
+	if h.Timeout.Duration == 0 {
+		h.Timeout.Duration = time.Second
+	}
+	if h.Interval.Duration > 0 && h.Timeout.Duration > h.Interval.Duration {
+		h.Timeout.Duration = h.Interval.Duration
+	}
+	if h.Rise == 0 {
+		h.Rise = 2
+	}
+	if h.Fall == 0 {
+		h.Fall = 3
+	}
+}
+
+// checkingHealth is set when health checks run, so nodes that are marked
+// down are added back.
+var checkingHealth bool
+
+// checkHealth probes every node on each interval and moves it in or out of
+// the ring once it passes the rise or fall threshold.
+func checkHealth(h healthConfig) {
+	for range time.Tick(h.Interval.Duration) {
+		var wg sync.WaitGroup
+		for _, n := range allNodes() {
+			wg.Add(1)
+			go func(n *node) {
+				defer wg.Done()
+				n.record(n.probe(h.Timeout.Duration), h)
+			}(n)
+		}
+		wg.Wait()
+	}
+}
+
+// adminPort defaults to the statsd convention of the udp port plus one.
+func (n *node) adminPort() int {
+	if n.AdminPort == 0 {
+		return n.Port + 1
+	}
+	return n.AdminPort
+}
+
+// probe sends the statsd admin health command and expects "health: up".
+func (n *node) probe(timeout time.Duration) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.adminPort()))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write([]byte("health\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if status := strings.TrimSpace(line); status != "health: up" {
+		return fmt.Errorf("unexpected health response %q", status)
+	}
+	return nil
+}
+
+func (n *node) record(err error, h healthConfig) {
+	membership.Lock()
+	if err == nil {
+		n.failures = 0
+		n.successes++
+	} else {
+		n.successes = 0
+		n.failures++
+	}
+	successes, failures, observed := n.successes, n.failures, n.damp.observed
+	membership.Unlock()
+
+	if err == nil && successes >= h.Rise && !observed {
+		log.Printf("node %s is up after %d successful checks", n.Name(), successes)
+		n.observe(true)
+	}
+	if err != nil && failures >= h.Fall && observed {
+		log.Printf("node %s is down after %d failed checks: %v", n.Name(), failures, err)
+		n.observe(false)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func adminServer(t *testing.T, status string) (net.Listener, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("should be able to start the admin server", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte("health: " + status + "\n"))
+			conn.Close()
+		}
+	}()
+	return l, l.Addr().(*net.TCPAddr).Port
+}
+
+func TestProbe(t *testing.T) {
+	l, port := adminServer(t, "up")
+	n := node{Host: "127.0.0.1", Port: 9000, AdminPort: port}
+	if err := n.probe(100 * time.Millisecond); err != nil {
+		t.Error("probe should succeed against a healthy node", err)
+	}
+	l.Close()
+
+	l, port = adminServer(t, "down")
+	defer l.Close()
+	n.AdminPort = port
+	if err := n.probe(100 * time.Millisecond); err == nil {
+		t.Error("probe should fail when statsd reports it is down")
+	}
+}
+
+func TestAdminPort(t *testing.T) {
+	n := node{Host: "127.0.0.1", Port: 8125}
+	if n.adminPort() != 8126 {
+		t.Error("expected the admin port to default to 8126, but it was", n.adminPort())
+	}
+}
+
+func TestRecord(t *testing.T) {
+	h := healthConfig{}
+	h.setDefaults()
+	n := node{Host: "127.0.0.1", Port: 9000}
+	insert(&n)
+	defer n.Remove()
+
+	for i := 0; i < h.Fall; i++ {
+		if !n.isUp() {
+			t.Error("node should stay up until it fails", h.Fall, "checks")
+		}
+		n.record(errTest, h)
+	}
+	if n.isUp() || inRing(n.Name()) {
+		t.Error("node should be removed after", h.Fall, "failed checks")
+	}
+
+	for i := 0; i < h.Rise; i++ {
+		if n.isUp() {
+			t.Error("node should stay down until it passes", h.Rise, "checks")
+		}
+		n.record(nil, h)
+	}
+	if !n.isUp() || !inRing(n.Name()) {
+		t.Error("node should be added after", h.Rise, "successful checks")
+	}
+}
+
+func TestWriteFailed(t *testing.T) {
+	n := node{Host: "127.0.0.1", Port: 9001}
+	insert(&n)
+	defer n.Remove()
+
+	n.writeFailed()
+	if !n.isUp() {
+		t.Error("expected a failed write to keep the node in the ring without health checks")
+	}
+
+	checkingHealth = true
+	defer func() { checkingHealth = false }()
+	n.writeFailed()
+	if n.isUp() {
+		t.Error("expected a failed write to take the node out of the ring while health checks run")
+	}
+	if n.writeErrors.Value() != 2 {
+		t.Error("expected 2 write errors, but there were", n.writeErrors.Value())
+	}
+}
+
+var errTest = errors.New("connection refused")
+
+func inRing(name string) bool {
+	for _, m := range currentRoutes().router.Members() {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
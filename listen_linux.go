@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeReusePortConn opens a socket that shares its address with the other
+// readers so the kernel spreads datagrams across them.
+func makeReusePortConn(version string, port int, host string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+
+	addr := makeAddr(port, host)
+	conn, err := lc.ListenPacket(context.Background(), version, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
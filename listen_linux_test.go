@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReusePort(t *testing.T) {
+	first, err := makeReusePortConn("udp4", 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to open a reuseport socket", err)
+	}
+	defer first.Close()
+
+	port := first.LocalAddr().(*net.UDPAddr).Port
+	second, err := makeReusePortConn("udp4", port, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to open a second socket on the same port", err)
+	}
+	second.Close()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func makeReusePortConn(version string, port int, host string) (*net.UDPConn, error) {
+	return nil, errors.New("multiple readers need SO_REUSEPORT, which is only supported on linux")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// lookup prints the node that owns each metric and the nodes that would
+// take over if it went down.
+func lookup(args []string) {
+	flags := flag.NewFlagSet("lookup", flag.ExitOnError)
+	env := flags.String("e", "development", "the program environment")
+	fallbacks := flags.Int("n", 2, "the number of fallback nodes to print")
+	flags.Parse(args)
+
+	if _, err := loadRoutes(*env); err != nil {
+		log.Fatal(err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "metric\tnode\tfallbacks")
+
+	names := flags.Args()
+	if len(names) == 0 || (len(names) == 1 && names[0] == "-") {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			printLookup(tw, scanner.Text(), *fallbacks)
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, name := range names {
+		printLookup(tw, name, *fallbacks)
+	}
+}
+
+func printLookup(w io.Writer, line string, fallbacks int) {
+	name := string(key([]byte(line)))
+	if name == "" {
+		return
+	}
+	nodes, err := currentRoutes().lookup(name, fallbacks)
+	if err != nil {
+		fmt.Fprintf(w, "%s\t%v\t\n", name, err)
+		return
+	}
+	var rest []string
+	for _, n := range nodes[1:] {
+		rest = append(rest, n.Name())
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\n", name, nodes[0].Name(), strings.Join(rest, " "))
+}
@@ -4,15 +4,36 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
 )
 
 type node struct {
-	Host string
-	Port int
-	Addr net.UDPAddr
-	name string
+	Host      string
+	Port      int
+	AdminPort int
+	Weight    int
+	Protocol  string
+	Addr      net.UDPAddr
+	name      string
+	slot      int
+	up        bool
+	admin     string
+	damp      damper
+	batch     *batch
+	stream    *stream
+	successes int
+	failures  int
+
+	lines       counter
+	writeErrors counter
+	removals    counter
+	dropped     counter
 }
 
+// membership guards the ring state of every node and serializes changes to
+// the routing table.
+var membership sync.Mutex
+
 func (n *node) Name() string {
 	if n.name == "" {
 		n.name = fmt.Sprintf("%s:%d", n.Host, n.Port)
@@ -20,12 +41,80 @@ func (n *node) Name() string {
 	return n.name
 }
 
+func (n *node) init() {
+	n.Addr = makeAddr(n.Port, n.Host)
+	if n.Protocol == "tcp" || n.Protocol == "tls" {
+		n.stream = newStream(n, streaming)
+	} else if batching.Interval.Duration > 0 {
+		n.batch = newBatch(batching.Size, &n.Addr)
+	}
+}
+
+func (n *node) weight() int {
+	if n.Weight < 1 {
+		return 1
+	}
+	return n.Weight
+}
+
+func (n *node) isUp() bool {
+	membership.Lock()
+	defer membership.Unlock()
+	return n.up
+}
+
+// Add puts the node in the ring right away, skipping any damping.
 func (n *node) Add() {
-	log.Println("adding node", n.Name())
-	cons.Add(n.Name())
+	membership.Lock()
+	defer membership.Unlock()
+	n.damp.observed = true
+	n.add()
 }
 
+// Remove takes the node out of the ring right away, skipping any damping.
 func (n *node) Remove() {
+	membership.Lock()
+	defer membership.Unlock()
+	n.damp.observed = false
+	n.remove()
+}
+
+// state describes the node for the admin api. The caller must hold
+// membership.
+func (n *node) state() string {
+	switch {
+	case n.admin != "":
+		return n.admin
+	case n.up:
+		return "up"
+	}
+	return "down"
+}
+
+func (n *node) add() {
+	if n.up || !n.known() {
+		return
+	}
+	log.Println("adding node", n.Name())
+	n.up = true
+	publish(currentRoutes().nodes)
+}
+
+func (n *node) remove() {
+	if !n.up || !n.known() {
+		return
+	}
 	log.Println("removing node", n.Name())
-	cons.Remove(n.Name())
+	n.up = false
+	n.removals.Inc()
+	publish(currentRoutes().nodes)
+}
+
+// writeFailed counts a failed write. The node is only marked down when
+// health checks are running to add it back once it recovers.
+func (n *node) writeFailed() {
+	n.writeErrors.Inc()
+	if checkingHealth {
+		n.observe(false)
+	}
 }
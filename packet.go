@@ -2,8 +2,7 @@ package main
 
 import (
 	"bytes"
-	"io"
-	"log"
+	"errors"
 	"net"
 )
 
@@ -12,51 +11,105 @@ type packet struct {
 	Buffer []byte
 }
 
-func (p *packet) handle(conn *net.UDPConn) {
-	buffer := bytes.NewBuffer(p.Buffer[:p.Length])
-	var pos int
+var (
+	errMalformed   = errors.New("malformed line")
+	errNoBackend   = errors.New("no backend in the ring")
+	errUnknownNode = errors.New("ring member is not a known node")
+)
+
+// lineErrors counts and logs the lines that could not be routed, by error.
+var lineErrors = map[error]*struct {
+	reason string
+	count  counter
+	log    *rateLog
+}{
+	errMalformed:   {reason: "malformed", log: newRateLog(logInterval)},
+	errNoBackend:   {reason: "no_backend", log: newRateLog(logInterval)},
+	errUnknownNode: {reason: "unknown_node", log: newRateLog(logInterval)},
+}
+
+// trim drops the partial last line of a packet that filled the read buffer.
+func (p *packet) trim() {
+	p.Length = bytes.LastIndex(p.Buffer[:p.Length], []byte{'\n'})
+	if p.Length < 0 {
+		p.Length = 0
+	}
+}
+
+// handle forwards each line to its node. When out is set lines that are not
+// batched per node are sent together once the packet is read.
+func (p *packet) handle(conn *net.UDPConn, out *mmsgWriter) {
+	buffer := p.Buffer[:p.Length]
+	r := currentRoutes()
 
-	for {
+	for len(buffer) > 0 {
 		// read the next command
-		line, err := buffer.ReadBytes('\n')
-		if err != nil && err != io.EOF {
-			log.Fatal(err)
+		line := buffer
+		if i := bytes.IndexByte(buffer, '\n'); i >= 0 {
+			line, buffer = buffer[:i], buffer[i+1:]
+		} else {
+			buffer = nil
 		}
 		if len(line) == 0 {
-			break
-		}
-		if err != io.EOF {
-			line = line[:len(line)-1]
+			continue
 		}
+		linesReceived.Inc()
 
-		// read the key
-		metric, err := bytes.NewBuffer(line).ReadBytes(':')
-		if err != nil && err != io.EOF {
-			log.Fatal(err)
+		if isEvent(line) {
+			eventsReceived.Inc()
+			nodes, err := events.route(r, line)
+			if err != nil {
+				dropLine(line, err)
+				continue
+			}
+			for _, n := range nodes {
+				forward(conn, out, n, line)
+			}
+			continue
 		}
-		key := string(metric[:len(metric)-1])
 
-		// get the client
-		name, err := cons.Get(key)
+		m, err := parseLine(line)
 		if err != nil {
-			log.Fatal(err)
-		}
-		n, found := clientMap[name]
-		if !found {
-			log.Fatal("unknown client for key", key)
+			invalidLines.Inc()
+			switch invalid {
+			case "drop":
+				invalidLog.Printf("dropping %q: %v", line, err)
+				continue
+			case "quarantine":
+				quarantinedLines.Inc()
+				quarantine.Printf("%q: %v", line, err)
+				continue
+			}
 		}
 
-		// write to the statsd server
-		_, err = conn.WriteToUDP(line, &n.Addr)
+		n, err := r.route(m.hashKey())
 		if err != nil {
-			n.Remove()
+			dropLine(line, err)
 			continue
 		}
+		forward(conn, out, n, line)
+	}
 
-		// check position
-		pos += len(line)
-		if pos == p.Length {
-			break
-		}
+	if out != nil {
+		out.flush()
+	}
+}
+
+// forward writes the line to the statsd server.
+func forward(conn *net.UDPConn, out *mmsgWriter, n *node, line []byte) {
+	n.lines.Inc()
+	if out != nil && n.batch == nil && n.stream == nil {
+		out.add(n, line)
+	} else if err := n.send(conn, line); err != nil {
+		n.writeFailed()
+	}
+}
+
+func dropLine(line []byte, err error) {
+	e, found := lineErrors[err]
+	if !found {
+		e = lineErrors[errMalformed]
 	}
+	e.count.Inc()
+	e.log.Printf("dropping %q: %v", line, err)
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strconv"
+)
+
+// metric is one statsd line split into its fields. The fields point into the
+// line they were parsed from.
+type metric struct {
+	Name      []byte
+	Value     []byte
+	Type      []byte
+	Rate      []byte
+	Tags      []byte
+	Container []byte
+	Timestamp []byte
+}
+
+var (
+	errNoName    = errors.New("missing metric name")
+	errNoType    = errors.New("missing metric type")
+	errBadType   = errors.New("unknown metric type")
+	errBadValue  = errors.New("invalid metric value")
+	errBadRate   = errors.New("invalid sample rate")
+	errBadTags   = errors.New("invalid tags")
+	errBadField  = errors.New("unknown field")
+	errDuplicate = errors.New("duplicate field")
+)
+
+// invalid is what happens to lines that fail to parse: they are dropped,
+// passed through to the node that owns their name, or written to the
+// quarantine log.
+var (
+	invalid    = "pass"
+	quarantine *log.Logger
+	invalidLog = newRateLog(logInterval)
+)
+
+var types = map[string]bool{"c": true, "g": true, "ms": true, "h": true, "s": true, "d": true}
+
+// parseLine parses name:value|type[|@rate][|#tags], along with the DogStatsD
+// extensions: several values joined by ':', a container id field starting
+// with "c:" and a unix timestamp field starting with "T". The name is set
+// whenever the line has one, even if the rest of it is invalid.
+func parseLine(line []byte) (metric, error) {
+	var m metric
+	i := bytes.IndexByte(line, ':')
+	if i <= 0 {
+		return m, errNoName
+	}
+	m.Name = line[:i]
+
+	fields := bytes.Split(line[i+1:], []byte{'|'})
+	if len(fields) < 2 {
+		return m, errNoType
+	}
+	m.Value, m.Type = fields[0], fields[1]
+	if !types[string(m.Type)] {
+		return m, errBadType
+	}
+	if !validValue(m.Value, m.Type) {
+		return m, errBadValue
+	}
+
+	for _, f := range fields[2:] {
+		if len(f) == 0 {
+			return m, errBadField
+		}
+		switch f[0] {
+		case '@':
+			if m.Rate != nil {
+				return m, errDuplicate
+			}
+			m.Rate = f[1:]
+			rate, err := strconv.ParseFloat(string(m.Rate), 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, errBadRate
+			}
+		case '#':
+			if m.Tags != nil {
+				return m, errDuplicate
+			}
+			m.Tags = f[1:]
+			if len(m.Tags) == 0 {
+				return m, errBadTags
+			}
+		case 'c':
+			if len(f) < 3 || f[1] != ':' {
+				return m, errBadField
+			}
+			if m.Container != nil {
+				return m, errDuplicate
+			}
+			m.Container = f[2:]
+		case 'T':
+			if m.Timestamp != nil {
+				return m, errDuplicate
+			}
+			m.Timestamp = f[1:]
+			if _, err := strconv.ParseUint(string(m.Timestamp), 10, 64); err != nil {
+				return m, errBadField
+			}
+		default:
+			return m, errBadField
+		}
+	}
+	return m, nil
+}
+
+func validValue(value, kind []byte) bool {
+	if len(value) == 0 {
+		return false
+	}
+	// sets count unique values of any kind
+	if string(kind) == "s" {
+		return true
+	}
+	for _, v := range bytes.Split(value, []byte{':'}) {
+		if _, err := strconv.ParseFloat(string(v), 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
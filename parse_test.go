@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestParseLine(t *testing.T) {
+	valid := []string{
+		"statsd.metric.test:1|c",
+		"statsd.metric.test:0.5|c|@0.1",
+		"statsd.metric.test:-3|g",
+		"statsd.metric.test:+3|g",
+		"statsd.metric.test:320|ms|@0.5|#env:prod",
+		"statsd.metric.test:12|h|#env:prod,host:a",
+		"statsd.metric.test:user-42|s",
+		"statsd.metric.test:1.5|d",
+	}
+	for _, line := range valid {
+		if _, err := parseLine([]byte(line)); err != nil {
+			t.Error("expected", line, "to be valid, but it returned", err)
+		}
+	}
+
+	invalid := map[string]error{
+		"foo":                          errNoName,
+		":1|c":                         errNoName,
+		"statsd.metric.test:1":         errNoType,
+		"statsd.metric.test:1|x":       errBadType,
+		"statsd.metric.test:|c":        errBadValue,
+		"statsd.metric.test:one|c":     errBadValue,
+		"statsd.metric.test:1|c|@2":    errBadRate,
+		"statsd.metric.test:1|c|@":     errBadRate,
+		"statsd.metric.test:1|c|#":     errBadTags,
+		"statsd.metric.test:1|c|x":     errBadField,
+		"statsd.metric.test:1|c|@1|@1": errDuplicate,
+	}
+	for line, expected := range invalid {
+		if _, err := parseLine([]byte(line)); err != expected {
+			t.Error("expected", line, "to return", expected, "but it returned", err)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	m, err := parseLine([]byte("api.latency:12|ms|@0.5|#env:prod"))
+	if err != nil {
+		t.Fatal("expected the line to be valid", err)
+	}
+	if string(m.Name) != "api.latency" || string(m.Value) != "12" || string(m.Type) != "ms" {
+		t.Error("expected api.latency:12|ms, but parsed", string(m.Name), string(m.Value), string(m.Type))
+	}
+	if string(m.Rate) != "0.5" || string(m.Tags) != "env:prod" {
+		t.Error("expected rate 0.5 and tags env:prod, but parsed", string(m.Rate), string(m.Tags))
+	}
+
+	m, _ = parseLine([]byte("api.latency:12"))
+	if string(m.Name) != "api.latency" {
+		t.Error("expected the name of an invalid line to be parsed, but it was", string(m.Name))
+	}
+}
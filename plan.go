@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// nodeFlags collects repeated host:port flags.
+type nodeFlags []node
+
+func (f *nodeFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *nodeFlags) Set(s string) error {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, node{Host: host, Port: p})
+	return nil
+}
+
+// plan reports how many keys move when nodes are added or removed.
+func plan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	env := flags.String("e", "development", "the program environment")
+	keys := flags.String("keys", "", "a file of metric names or statsd lines, - for stdin")
+	capture := flags.Duration("capture", 0, "sample metric names from live traffic for this long")
+	listen := flags.String("listen", "", "the host:port to capture traffic on, defaults to the proxy address")
+	var adds, removes nodeFlags
+	flags.Var(&adds, "add", "the host:port of a node to add, may be repeated")
+	flags.Var(&removes, "remove", "the host:port of a node to remove, may be repeated")
+	flags.Parse(args)
+
+	c, err := loadRoutes(*env)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var sample map[string]int
+	switch {
+	case *keys == "-":
+		sample, err = readKeys(os.Stdin)
+	case *keys != "":
+		var file *os.File
+		if file, err = os.Open(*keys); err == nil {
+			sample, err = readKeys(file)
+			file.Close()
+		}
+	case *capture > 0:
+		addr := *listen
+		if addr == "" {
+			addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+		}
+		sample, err = captureKeys(c.UdpVersion, addr, *capture)
+	default:
+		err = errors.New("plan needs a -keys file or a -capture duration")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	current := currentRoutes()
+	proposed := propose(current, adds, removes)
+	movement(current, proposed, sample).print(os.Stdout)
+}
+
+// propose copies the nodes of r, adding and removing the given nodes.
+func propose(r *routes, adds, removes []node) *routes {
+	nodes := make(map[string]*node, len(r.nodes)+len(adds))
+	last := -1
+	for name, n := range r.nodes {
+		nodes[name] = n
+		if n.slot > last {
+			last = n.slot
+		}
+	}
+	// new nodes are added to the end of the config
+	for i := range adds {
+		n := &adds[i]
+		n.up = true
+		n.slot = last + 1 + i
+		nodes[n.Name()] = n
+	}
+	for i := range removes {
+		delete(nodes, removes[i].Name())
+	}
+	return newRoutes(nodes)
+}
+
+// key returns what a statsd line is routed on, as set by HashKey. A bare
+// metric name is its own key.
+func key(line []byte) []byte {
+	line = bytes.TrimSpace(line)
+	if bytes.IndexByte(line, ':') < 0 {
+		return line
+	}
+	m, _ := parseLine(line)
+	return m.hashKey()
+}
+
+// readKeys counts the metric names in r, one name or statsd line per line.
+func readKeys(r io.Reader) (map[string]int, error) {
+	sample := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if k := key(scanner.Bytes()); len(k) > 0 {
+			sample[string(k)]++
+		}
+	}
+	return sample, scanner.Err()
+}
+
+// captureKeys counts the metric names sent to addr for the given time.
+func captureKeys(version, addr string, d time.Duration) (map[string]int, error) {
+	conn, err := net.ListenPacket(version, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sample := make(map[string]int)
+	conn.SetReadDeadline(time.Now().Add(d))
+	b := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return sample, nil
+			}
+			return nil, err
+		}
+		for _, line := range bytes.Split(b[:n], []byte{'\n'}) {
+			if k := key(line); len(k) > 0 {
+				sample[string(k)]++
+			}
+		}
+	}
+}
+
+// moves is how a sample of keys is spread over the nodes before and after a
+// change, counted by distinct name and by line.
+type moves struct {
+	names, lines           int
+	movedNames, movedLines int
+	before, after          map[string]int
+}
+
+func movement(before, after *routes, sample map[string]int) *moves {
+	m := &moves{before: make(map[string]int), after: make(map[string]int)}
+	for k, count := range sample {
+		a, aerr := before.route([]byte(k))
+		b, berr := after.route([]byte(k))
+		m.names++
+		m.lines += count
+		if aerr == nil {
+			m.before[a.Name()] += count
+		}
+		if berr == nil {
+			m.after[b.Name()] += count
+		}
+		if a != b {
+			m.movedNames++
+			m.movedLines += count
+		}
+	}
+	return m
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func (m *moves) print(w io.Writer) {
+	fmt.Fprintf(w, "%d of %d metric names move (%.1f%%)\n", m.movedNames, m.names, percent(m.movedNames, m.names))
+	fmt.Fprintf(w, "%d of %d lines move (%.1f%%)\n\n", m.movedLines, m.lines, percent(m.movedLines, m.lines))
+
+	var names []string
+	for name := range m.before {
+		names = append(names, name)
+	}
+	for name := range m.after {
+		if _, found := m.before[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "node\tbefore\tafter")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\n", name, percent(m.before[name], m.lines), percent(m.after[name], m.lines))
+	}
+	tw.Flush()
+}
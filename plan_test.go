@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadKeys(t *testing.T) {
+	sample, err := readKeys(strings.NewReader("statsd.metric.test:1|c\nstatsd.metric.test:2|c\n\nstatsd.metric.name\n"))
+	if err != nil {
+		t.Fatal("readKeys should not return an error", err)
+	}
+	if len(sample) != 2 || sample["statsd.metric.test"] != 2 || sample["statsd.metric.name"] != 1 {
+		t.Error("expected names and statsd lines to be counted by name, but the sample was", sample)
+	}
+}
+
+func TestMovement(t *testing.T) {
+	nodes := map[string]*node{}
+	for i := 0; i < 3; i++ {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, up: true}
+		nodes[n.Name()] = n
+	}
+	before := newRoutes(nodes)
+	after := propose(before, []node{{Host: "127.0.0.1", Port: 9103}}, []node{{Host: "127.0.0.1", Port: 9100}})
+
+	sample := make(map[string]int)
+	for _, k := range sampleKeys(1000) {
+		sample[k] = 2
+	}
+	m := movement(before, after, sample)
+	if m.names != 1000 || m.lines != 2000 {
+		t.Error("expected 1000 names and 2000 lines, but there were", m.names, m.lines)
+	}
+	if m.after["127.0.0.1:9100"] != 0 {
+		t.Error("expected the removed node to own no keys")
+	}
+	moved := m.before["127.0.0.1:9100"] + m.after["127.0.0.1:9103"] - m.before["127.0.0.1:9103"]
+	if m.movedLines < m.before["127.0.0.1:9100"] || m.movedLines > moved {
+		t.Error("expected only the keys of the removed and added nodes to move, but", m.movedLines, "lines moved")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// writePrometheus writes the stats in the prometheus text format.
+func writePrometheus(w io.Writer, stats []stat) {
+	for i, s := range stats {
+		name := "statsd_proxy_" + s.name
+		if !s.gauge {
+			name += "_total"
+		}
+		if i == 0 || stats[i-1].name != s.name {
+			kind := "counter"
+			if s.gauge {
+				kind = "gauge"
+			}
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, s.help, name, kind)
+		}
+		if s.label != "" {
+			fmt.Fprintf(w, "%s{%s=%q} %d\n", name, s.label, s.value, s.count)
+		} else {
+			fmt.Fprintf(w, "%s %d\n", name, s.count)
+		}
+	}
+}
+
+func showMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writePrometheus(w, collect())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	var b bytes.Buffer
+	writePrometheus(&b, []stat{
+		{name: "packets_received", help: "Datagrams read from clients.", count: 3},
+		{name: "node_up", help: "Whether the node is in the hash ring.", gauge: true, label: "node", value: "127.0.0.1:8127", count: 1},
+		{name: "node_up", help: "Whether the node is in the hash ring.", gauge: true, label: "node", value: "127.0.0.1:8129", count: 0},
+	})
+	expected := `# HELP statsd_proxy_packets_received_total Datagrams read from clients.
+# TYPE statsd_proxy_packets_received_total counter
+statsd_proxy_packets_received_total 3
+# HELP statsd_proxy_node_up Whether the node is in the hash ring.
+# TYPE statsd_proxy_node_up gauge
+statsd_proxy_node_up{node="127.0.0.1:8127"} 1
+statsd_proxy_node_up{node="127.0.0.1:8129"} 0
+`
+	if b.String() != expected {
+		t.Error("expected the prometheus text format, but it was", b.String())
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	setupTest(t)
+	conn, addr := newConn(t)
+	conn.WriteTo([]byte("statsd.metric.test:1|c"), &addr)
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+
+	server := httptest.NewServer(adminMux())
+	defer server.Close()
+	res, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal("admin GET should not return an error", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	for _, s := range []string{
+		"statsd_proxy_ring_members 3\n",
+		`statsd_proxy_node_up{node="127.0.0.1:8129"} 1`,
+		`statsd_proxy_lines_dropped_total{reason="malformed"}`,
+	} {
+		if !strings.Contains(string(body), s) {
+			t.Error("expected the metrics to contain", s)
+		}
+	}
+	if strings.Contains(string(body), "statsd_proxy_packets_received_total 0\n") {
+		t.Error("expected the received packets to be counted")
+	}
+	if strings.Contains(string(body), `statsd_proxy_node_lines_total{node="127.0.0.1:8129"} 0`) {
+		t.Error("expected the lines sent to 127.0.0.1:8129 to be counted")
+	}
+}
@@ -2,16 +2,16 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
 	"runtime"
-
-	"stathat.com/c/consistent"
+	"syscall"
+	"time"
 )
 
-var clientMap map[string]*node = make(map[string]*node)
-var cons = consistent.New()
-
 func makeAddr(port int, host string) net.UDPAddr {
 	return net.UDPAddr{Port: port, IP: net.ParseIP(host)}
 }
@@ -23,51 +23,267 @@ func makeConn(version string, port int, host string) (*net.UDPConn, error) {
 
 func setup(nodes []node) {
 	// setup clients and hash ring
-	cons.NumberOfReplicas = 1
-	for i := 0; i < len(nodes); i++ {
+	added := make([]*node, len(nodes))
+	for i := range nodes {
 		n := &nodes[i]
-		n.Addr = makeAddr(n.Port, n.Host)
-		n.Add()
-		clientMap[n.Name()] = n
+		n.slot = i
+		n.init()
+		added[i] = n
+	}
+	insert(added...)
+}
+
+type server struct {
+	conns   []*net.UDPConn
+	unix    *net.UnixConn
+	workers *workers
+	tcp     *tcpServer
+	errs    chan error
+}
+
+func listen(c *config) ([]*net.UDPConn, error) {
+	if c.Readers == 1 {
+		conn, err := makeConn(c.UdpVersion, c.Port, c.Host)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
 	}
+
+	conns := make([]*net.UDPConn, c.Readers)
+	for i := range conns {
+		conn, err := makeReusePortConn(c.UdpVersion, c.Port, c.Host)
+		if err != nil {
+			for _, conn := range conns[:i] {
+				conn.Close()
+			}
+			return nil, err
+		}
+		conns[i] = conn
+	}
+	return conns, nil
 }
 
-func startServer(version string, port int, host string) error {
-	conn, err := makeConn(version, port, host)
+func startServer(c *config) (*server, error) {
+	conns, err := listen(c)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var unix *net.UnixConn
+	if c.Unix.Path != "" {
+		if unix, err = listenUnix(c.Unix); err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, err
+		}
 	}
 
-	return readPackets(conn)
+	// the workers forward through the first socket
+	s := &server{
+		conns:   conns,
+		unix:    unix,
+		workers: newWorkers(conns[0], c),
+		errs:    make(chan error, len(conns)+1),
+	}
+	if c.TCP.Addr != "" {
+		if s.tcp, err = listenTCP(c.TCP, s.workers); err != nil {
+			s.workers.stop()
+			for _, conn := range conns {
+				conn.Close()
+			}
+			if unix != nil {
+				closeUnix(unix)
+			}
+			return nil, err
+		}
+	}
+	for _, conn := range conns {
+		go func(conn *net.UDPConn) {
+			s.errs <- read(conn, s.workers, c)
+		}(conn)
+	}
+	if unix != nil {
+		go func() {
+			s.errs <- readUnix(unix, s.workers)
+		}()
+	}
+	return s, nil
 }
 
-func readPackets(conn *net.UDPConn) error {
-	defer conn.Close()
+// stop stops reading, forwards the packets that are already queued and
+// flushes the batches, giving up after timeout.
+func (s *server) stop(timeout time.Duration) error {
+	// a read deadline in the past stops the readers but keeps the first
+	// socket open for the workers
+	readers := len(s.conns)
+	for _, conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	if s.unix != nil {
+		readers++
+		s.unix.SetReadDeadline(time.Now())
+	}
+	defer func() {
+		for _, conn := range s.conns {
+			conn.Close()
+		}
+		if s.unix != nil {
+			closeUnix(s.unix)
+		}
+	}()
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < readers; i++ {
+			<-s.errs
+		}
+		if s.tcp != nil {
+			s.tcp.stop()
+		}
+		s.workers.stop()
+		flushAll()
+		close(done)
+	}()
 
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("gave up draining after %s", timeout)
+	}
+}
+
+func read(conn *net.UDPConn, w *workers, c *config) error {
+	if c.IOBatch > 0 {
+		return readBatches(conn, w, c.IOBatch)
+	}
+	return readPackets(conn, w)
+}
+
+func readPackets(conn *net.UDPConn, w *workers) error {
 	for {
-		b := make([]byte, 1024)
-		n, _, err := conn.ReadFromUDP(b)
+		p := w.get()
+		n, addr, err := conn.ReadFromUDP(p.Buffer)
 		if err != nil {
+			w.put(p)
 			return err
 		}
-		p := packet{Length: n, Buffer: b}
-		go p.handle(conn)
+		p.Length = n
+		received(p, addr)
+		w.queue(p)
 	}
-	return nil
+}
+
+var truncatedLog = newRateLog(logInterval)
+
+// received checks a packet that was just read for truncation.
+func received(p *packet, addr net.Addr) {
+	packetsReceived.Inc()
+	bytesReceived.Add(uint64(p.Length))
+	if size := len(p.Buffer) - 1; p.Length > size {
+		truncatedPackets.Inc()
+		truncatedLog.Printf("packet from %s is larger than the %d byte read buffer, dropping its last line", addr, size)
+		p.trim()
+	}
+}
+
+// loadRoutes reads the config and builds the routing table from its nodes.
+func loadRoutes(env string) (*config, error) {
+	var c config
+	if err := c.read(env); err != nil {
+		return nil, err
+	}
+	replicas = c.Replicas
+	hashing = c.Hash
+	setHashKey(c.HashKey, c.HashTags)
+	events = c.Events
+	damping = c.Damping
+	batching = c.Batch
+	streaming = c.Stream
+	setup(c.Nodes)
+	return &c, nil
+}
+
+// commands are run instead of the proxy when named as the first argument.
+var commands = map[string]func(args []string){
+	"plan":   plan,
+	"lookup": lookup,
 }
 
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	env := flag.String("e", "development", "the program environment")
 	flag.Parse()
 
-	var c config
-	err := c.read(*env)
+	c, err := loadRoutes(*env)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	setup(c.Nodes)
-	log.Fatal(startServer(c.UdpVersion, c.Port, c.Host))
+	invalid = c.Invalid
+	if invalid == "quarantine" {
+		file, err := os.OpenFile(c.Quarantine, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		quarantine = log.New(file, "", log.LstdFlags)
+	}
+	if batching.Interval.Duration > 0 {
+		go flushBatches(batching.Interval.Duration)
+	}
+	if damping.enabled() {
+		go settleNodes()
+	}
+	if c.Health.Interval.Duration > 0 {
+		checkingHealth = true
+		go checkHealth(c.Health)
+	}
+
+	if c.Admin != "" {
+		if err = startAdmin(c.Admin); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if c.SelfStats.Interval.Duration > 0 {
+		if err = startReporter(c.SelfStats, c.UdpVersion); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s, err := startServer(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case err = <-s.errs:
+			log.Fatal(err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err = reload(*env); err != nil {
+					log.Println("unable to reload the config", err)
+				}
+				continue
+			}
+			log.Println("received", sig, "draining for up to", c.DrainTimeout)
+			if err = s.stop(c.DrainTimeout.Duration); err != nil {
+				log.Fatal(err)
+			}
+			log.Println("drained")
+			return
+		}
+	}
 }
@@ -10,7 +10,7 @@ var serverMap map[string]*net.UDPConn = make(map[string]*net.UDPConn)
 var c config
 var initialized bool = false
 
-func setupTest(t *testing.T) {
+func setupTest(t testing.TB) {
 	if initialized {
 		return
 	}
@@ -23,10 +23,14 @@ func setupTest(t *testing.T) {
 
 	setup(c.Nodes)
 	makeServers(t)
-	go startServer(c.UdpVersion, c.Port, c.Host)
+	conn, err := makeConn(c.UdpVersion, c.Port, c.Host)
+	if err != nil {
+		t.Error("should be able to start the proxy", err)
+	}
+	go readPackets(conn, newWorkers(conn, &c))
 }
 
-func makeServers(t *testing.T) {
+func makeServers(t testing.TB) {
 	for _, n := range c.Nodes {
 		conn, err := makeConn(c.UdpVersion, n.Port, n.Host)
 		if err != nil {
@@ -36,7 +40,7 @@ func makeServers(t *testing.T) {
 	}
 }
 
-func newConn(t *testing.T) (net.PacketConn, net.UDPAddr) {
+func newConn(t testing.TB) (net.PacketConn, net.UDPAddr) {
 	conn, err := net.ListenPacket(c.UdpVersion, "127.0.0.1:0")
 	if err != nil {
 		t.Error("should be able to create a connection", err)
@@ -47,14 +51,14 @@ func newConn(t *testing.T) (net.PacketConn, net.UDPAddr) {
 
 func TestSetup(t *testing.T) {
 	setupTest(t)
-	name, err := cons.Get("statsd.metric.test")
+	name, err := currentRoutes().router.Get("statsd.metric.test")
 	if err != nil {
 		t.Error("cons should not return an error", err)
 	}
 	if name != "127.0.0.1:8129" {
 		t.Error("expected name to be 127.0.0.1:8129, but it was", name)
 	}
-	name, err = cons.Get("statsd.metric.name")
+	name, err = currentRoutes().router.Get("statsd.metric.name")
 	if err != nil {
 		t.Error("cons should not return an error", err)
 	}
@@ -86,6 +90,60 @@ func TestMultipleMetrics(t *testing.T) {
 	readMetric("127.0.0.1:8127", "statsd.metric.name:2|g", t)
 }
 
+func TestMalformedLine(t *testing.T) {
+	setupTest(t)
+	malformed := lineErrors[errMalformed].count.Value()
+	conn, addr := newConn(t)
+	_, err := conn.WriteTo([]byte("foo\n:1|c\nstatsd.metric.test:1|c"), &addr)
+	if err != nil {
+		t.Error("conn Write should not return an error", err)
+	}
+
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+	if count := lineErrors[errMalformed].count.Value() - malformed; count != 2 {
+		t.Error("expected 2 malformed lines to be counted, but there were", count)
+	}
+}
+
+func TestStop(t *testing.T) {
+	setupTest(t)
+	sc := c
+	sc.Port = 0
+	sc.Host = "127.0.0.1"
+	s, err := startServer(&sc)
+	if err != nil {
+		t.Fatal("should be able to start the server", err)
+	}
+
+	p := s.workers.get()
+	p.Length = copy(p.Buffer, "statsd.metric.name:3|c")
+	s.workers.queue(p)
+	if err = s.stop(time.Second); err != nil {
+		t.Error("stop should drain the queue", err)
+	}
+	readMetric("127.0.0.1:8127", "statsd.metric.name:3|c", t)
+
+	if _, _, err = s.conns[0].ReadFromUDP(p.Buffer); err == nil {
+		t.Error("expected the socket to be closed once the server stopped")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	b := []byte("statsd.metric.test:1|c\nstatsd.metric.name:2|g\nstatsd.metric.trun")
+	p := packet{Length: len(b), Buffer: b}
+	p.trim()
+	if cmd := string(p.Buffer[:p.Length]); cmd != "statsd.metric.test:1|c\nstatsd.metric.name:2|g" {
+		t.Error("expected the partial last line to be dropped, but the packet was", cmd)
+	}
+
+	b = []byte("statsd.metric.trun")
+	p = packet{Length: len(b), Buffer: b}
+	p.trim()
+	if p.Length != 0 {
+		t.Error("expected a packet without a complete line to be empty, but its length was", p.Length)
+	}
+}
+
 func readMetric(server string, metric string, t *testing.T) {
 	node := serverMap[server]
 	err := node.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
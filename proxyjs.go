@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// proxyjsRouter reproduces the key to node mapping of Etsy's statsd
+// proxy.js, which builds its ring with the hashring npm module: md5, 40
+// virtual nodes per server, 4 points per virtual node and the same weight of
+// 100 for every node. Members must be named host:port as in proxy.js.
+type proxyjsRouter struct {
+	members []string
+	points  []proxyjsPoint
+}
+
+type proxyjsPoint struct {
+	value  uint32
+	member string
+}
+
+const (
+	proxyjsVnodes   = 40
+	proxyjsReplicas = 4
+	proxyjsWeight   = 100
+)
+
+// proxyjsHash reads the i-th little endian uint32 of the md5 digest.
+func proxyjsHash(digest [md5.Size]byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(digest[i*4:])
+}
+
+func newProxyjsRouter(members, _ []string) Router {
+	r := &proxyjsRouter{members: sorted(members)}
+
+	// hashring works out the virtual nodes from each server's share of
+	// the total weight; the float math is kept in the same order so the
+	// rounding matches javascript
+	total := float64(proxyjsWeight * len(r.members))
+	percentage := proxyjsWeight / total
+	length := int(math.Floor(percentage * proxyjsVnodes * float64(len(r.members))))
+
+	for _, m := range r.members {
+		for i := 0; i < length; i++ {
+			digest := md5.Sum([]byte(m + "-" + strconv.Itoa(i)))
+			for j := 0; j < proxyjsReplicas; j++ {
+				r.points = append(r.points, proxyjsPoint{proxyjsHash(digest, j), m})
+			}
+		}
+	}
+	sort.SliceStable(r.points, func(i, j int) bool {
+		return r.points[i].value < r.points[j].value
+	})
+	return r
+}
+
+// find is hashring's binary search, including the way it falls back to the
+// first point instead of the next one in some cases.
+func (r *proxyjsRouter) find(value uint32) int {
+	size := len(r.points)
+	low, high := 0, size
+	for {
+		middle := (low + high) >> 1
+		if middle == size {
+			return 0
+		}
+		mid := r.points[middle].value
+		var prev uint32
+		if middle > 0 {
+			prev = r.points[middle-1].value
+		}
+		if value <= mid && value > prev {
+			return middle
+		}
+		if mid < value {
+			low = middle + 1
+		} else {
+			high = middle - 1
+		}
+		if low > high {
+			return 0
+		}
+	}
+}
+
+func (r *proxyjsRouter) Get(key string) (string, error) {
+	if len(r.points) == 0 {
+		return "", errEmptyRouter
+	}
+	return r.points[r.find(proxyjsHash(md5.Sum([]byte(key)), 0))].member, nil
+}
+
+// GetN walks the ring from the key's point; proxy.js itself only uses the
+// owner.
+func (r *proxyjsRouter) GetN(key string, n int) ([]string, error) {
+	if len(r.points) == 0 {
+		return nil, errEmptyRouter
+	}
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+	var res []string
+	for i := r.find(proxyjsHash(md5.Sum([]byte(key)), 0)); len(res) < n; i = (i + 1) % len(r.points) {
+		if m := r.points[i].member; !picked(res, m) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func (r *proxyjsRouter) Members() []string {
+	return r.members
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The expected owners were computed in node with a transcription of the
+// hashring module's continuum, find and md5 digest functions, not with the
+// module itself. TestProxyjsHashring checks the same keys against the real
+// module wherever it is installed.
+func TestProxyjsGolden(t *testing.T) {
+	r := newProxyjsRouter([]string{"127.0.0.1:8127", "127.0.0.1:8129", "127.0.0.1:8131"}, nil)
+	golden := map[string]string{
+		"statsd.metric.test": "127.0.0.1:8129",
+		"statsd.metric.name": "127.0.0.1:8129",
+		"api.latency":        "127.0.0.1:8129",
+		"api.requests.count": "127.0.0.1:8127",
+		"app.web01.cpu.user": "127.0.0.1:8127",
+		"app.web02.cpu.user": "127.0.0.1:8129",
+		"db.queries.slow":    "127.0.0.1:8131",
+		"gorets":             "127.0.0.1:8131",
+		"glork":              "127.0.0.1:8129",
+		"gaugor":             "127.0.0.1:8129",
+		"uniques":            "127.0.0.1:8127",
+		"a":                  "127.0.0.1:8127",
+	}
+	for key, expected := range golden {
+		if m, _ := r.Get(key); m != expected {
+			t.Error("expected", key, "to be sent to", expected, "like proxy.js, but it was sent to", m)
+		}
+	}
+}
+
+// With seven nodes javascript rounds the virtual node count down to 39.
+func TestProxyjsGoldenRounding(t *testing.T) {
+	r := newProxyjsRouter(members(7), nil).(*proxyjsRouter)
+	if len(r.points) != 7*39*4 {
+		t.Error("expected 1092 points on the ring, but there were", len(r.points))
+	}
+	golden := map[string]string{
+		"app.host0.requests":  "10.0.0.15:8125",
+		"app.host1.requests":  "10.0.0.16:8125",
+		"app.host2.requests":  "10.0.0.10:8125",
+		"app.host3.requests":  "10.0.0.16:8125",
+		"app.host4.requests":  "10.0.0.12:8125",
+		"app.host5.requests":  "10.0.0.15:8125",
+		"app.host6.requests":  "10.0.0.10:8125",
+		"app.host7.requests":  "10.0.0.11:8125",
+		"app.host8.requests":  "10.0.0.13:8125",
+		"app.host9.requests":  "10.0.0.10:8125",
+		"app.host10.requests": "10.0.0.13:8125",
+		"app.host11.requests": "10.0.0.11:8125",
+	}
+	for key, expected := range golden {
+		if m, _ := r.Get(key); m != expected {
+			t.Error("expected", key, "to be sent to", expected, "like proxy.js, but it was sent to", m)
+		}
+	}
+}
+
+var goldenLine = regexp.MustCompile(`^\t\t"(.+)": "(.+)",$`)
+
+// TestProxyjsHashring runs testdata/proxyjs_golden.js, which asks the real
+// hashring module that proxy.js uses for the owners of the golden keys. It
+// is skipped unless node can load hashring, as after npm install hashring@3.
+func TestProxyjsHashring(t *testing.T) {
+	out, err := exec.Command("node", "testdata/proxyjs_golden.js").Output()
+	if err != nil {
+		t.Skip("unable to run hashring in node:", err)
+	}
+	routers := []Router{
+		newProxyjsRouter([]string{"127.0.0.1:8127", "127.0.0.1:8129", "127.0.0.1:8131"}, nil),
+		newProxyjsRouter(members(7), nil),
+	}
+
+	lines := strings.Split(string(out), "\n")
+	t.Log(lines[0])
+	group, checked := 0, 0
+	for _, line := range lines[1:] {
+		if line == "" {
+			group++
+			continue
+		}
+		m := goldenLine.FindStringSubmatch(line)
+		if m == nil || group >= len(routers) {
+			t.Fatal("unexpected output from proxyjs_golden.js:", line)
+		}
+		if owner, _ := routers[group].Get(m[1]); owner != m[2] {
+			t.Error("expected", m[1], "to be sent to", m[2], "like hashring, but it was sent to", owner)
+		}
+		checked++
+	}
+	if checked == 0 {
+		t.Error("expected proxyjs_golden.js to print the owners of the golden keys")
+	}
+}
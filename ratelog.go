@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// logInterval is how often each kind of dropped traffic is logged.
+const logInterval = 10 * time.Second
+
+// rateLog logs at most one message per interval and reports how many
+// messages it skipped in between.
+type rateLog struct {
+	sync.Mutex
+	interval time.Duration
+	last     time.Time
+	skipped  int
+}
+
+func newRateLog(interval time.Duration) *rateLog {
+	return &rateLog{interval: interval}
+}
+
+func (r *rateLog) Printf(format string, v ...interface{}) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.last) < r.interval {
+		r.skipped++
+		return
+	}
+	if r.skipped > 0 {
+		format += " (%d more since the last message)"
+		v = append(v, r.skipped)
+	}
+	log.Printf(format, v...)
+	r.last = now
+	r.skipped = 0
+}
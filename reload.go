@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+)
+
+// reload reads the config again and applies its node list.
+func reload(env string) error {
+	var c config
+	if err := c.read(env); err != nil {
+		return err
+	}
+	applyNodes(c.Nodes)
+	return nil
+}
+
+// applyNodes adds the new nodes and removes the missing ones, swapping the
+// ring in a single step. Nodes that are already known keep their state and
+// take their new Weight. A node whose Protocol or AdminPort changed is
+// replaced, starting over as a new node.
+func applyNodes(nodes []node) {
+	membership.Lock()
+	defer membership.Unlock()
+
+	current := currentRoutes()
+
+	next := make(map[string]*node)
+	for i := range nodes {
+		n := &nodes[i]
+		old, found := current.nodes[n.Name()]
+		if found && old.Protocol == n.Protocol && old.AdminPort == n.AdminPort {
+			if old.weight() != n.weight() {
+				log.Printf("changing the weight of node %s from %d to %d", n.Name(), old.weight(), n.weight())
+				old.Weight = n.Weight
+			}
+			old.slot = i
+			next[n.Name()] = old
+			continue
+		}
+		n.slot = i
+		if found {
+			log.Println("replacing node", n.Name(), "with its new Protocol and AdminPort")
+		} else {
+			log.Println("adding node", n.Name())
+		}
+		n.init()
+		n.up = true
+		n.damp.observed = true
+		next[n.Name()] = n
+	}
+
+	for name, n := range current.nodes {
+		if next[name] != n {
+			if next[name] == nil {
+				log.Println("removing node", name)
+			}
+			n.up = false
+			if n.stream != nil {
+				n.stream.close()
+			} else if n.batch != nil {
+				n.batch.Flush()
+			}
+		}
+	}
+	r := publish(next)
+	log.Printf("reloaded %d nodes, about %.1f%% of keys moved", len(next), 100*moved(current, r, sampleKeys(10000)))
+}
+
+// sampleKeys makes random metric names to estimate how many keys move.
+func sampleKeys(count int) []string {
+	r := rand.New(rand.NewSource(1))
+	keys := make([]string, count)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("statsd.%x.%x", r.Int63(), r.Int63())
+	}
+	return keys
+}
+
+// moved is the fraction of keys owned by a different node after the change.
+func moved(before, after *routes, keys []string) float64 {
+	count := 0
+	for _, key := range keys {
+		a, _ := before.router.Get(key)
+		b, _ := after.router.Get(key)
+		if a != b {
+			count++
+		}
+	}
+	return float64(count) / float64(len(keys))
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestApplyNodes(t *testing.T) {
+	setupTest(t)
+	var nodes []node
+	for i := range c.Nodes {
+		nodes = append(nodes, node{Host: c.Nodes[i].Host, Port: c.Nodes[i].Port})
+	}
+	nodes = append(nodes, node{Host: "127.0.0.1", Port: 8133})
+
+	applyNodes(nodes)
+	if len(allNodes()) != 4 || !inRing("127.0.0.1:8133") {
+		t.Error("expected 127.0.0.1:8133 to be added to the ring")
+	}
+
+	applyNodes(nodes[:2])
+	if len(allNodes()) != 2 || inRing("127.0.0.1:8131") || inRing("127.0.0.1:8133") {
+		t.Error("expected the nodes missing from the config to be removed, but the ring was", currentRoutes().router.Members())
+	}
+	// a health check that still holds the removed node must not add it back
+	c.Nodes[2].Add()
+	if len(allNodes()) != 2 || inRing("127.0.0.1:8131") {
+		t.Error("expected a removed node to stay out of the ring, but the ring was", currentRoutes().router.Members())
+	}
+
+	applyNodes(c.Nodes)
+	if len(currentRoutes().router.Members()) != 3 {
+		t.Error("expected the ring to be restored, but it was", currentRoutes().router.Members())
+	}
+	if currentRoutes().nodes["127.0.0.1:8127"] != &c.Nodes[0] {
+		t.Error("expected known nodes to keep their state")
+	}
+}
+
+func TestApplyNodeSettings(t *testing.T) {
+	setupTest(t)
+	defer applyNodes(c.Nodes)
+	var nodes []node
+	for i := range c.Nodes {
+		nodes = append(nodes, node{Host: c.Nodes[i].Host, Port: c.Nodes[i].Port})
+	}
+
+	nodes[0].Weight = 3
+	nodes[1].AdminPort = 9999
+	applyNodes(nodes)
+	r := currentRoutes()
+	if n := r.nodes["127.0.0.1:8127"]; n != &c.Nodes[0] || n.weight() != 3 || !inRing("127.0.0.1:8127#3") {
+		t.Error("expected the known node to keep its state and take its new weight")
+	}
+	if n := r.nodes["127.0.0.1:8129"]; n == &c.Nodes[1] || n.adminPort() != 9999 || !inRing("127.0.0.1:8129") {
+		t.Error("expected the node with a new admin port to be replaced")
+	}
+	if c.Nodes[1].isUp() {
+		t.Error("expected the replaced node to be out of the ring")
+	}
+	c.Nodes[0].Weight = 0
+}
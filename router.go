@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"stathat.com/c/consistent"
+)
+
+// Router maps a metric name to one of its members. Routers are built once
+// for each routing table and never change afterwards.
+type Router interface {
+	// Get returns the member that owns the key.
+	Get(key string) (string, error)
+	// GetN returns up to n distinct members for the key, owner first.
+	GetN(key string, n int) ([]string, error)
+	Members() []string
+}
+
+var errEmptyRouter = errors.New("no members to route to")
+
+// hashing names the Router used for new routing tables.
+var hashing = "ring"
+
+// routers build a Router from the members that are up. slots lists every
+// member of every known node, up or not, in config order, for routers that
+// give members fixed positions.
+var routers = map[string]func(members, slots []string) Router{
+	"ring":       newRingRouter,
+	"jump":       newJumpRouter,
+	"rendezvous": newRendezvousRouter,
+	"maglev":     newMaglevRouter,
+	"proxyjs":    newProxyjsRouter,
+}
+
+func newRouter(kind string, members, slots []string) Router {
+	return routers[kind](members, slots)
+}
+
+// hash64 is FNV-1a over the strings followed by a finalizer, since FNV
+// alone mixes similar short strings poorly.
+func hash64(s ...string) uint64 {
+	h := fnv.New64a()
+	for _, v := range s {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func sorted(members []string) []string {
+	s := append([]string{}, members...)
+	sort.Strings(s)
+	return s
+}
+
+// ringRouter is the stathat CRC32 ring the proxy has always used.
+type ringRouter struct {
+	*consistent.Consistent
+}
+
+func newRingRouter(members, _ []string) Router {
+	c := consistent.New()
+	c.NumberOfReplicas = replicas
+	c.Set(members)
+	return ringRouter{c}
+}
+
+// jumpRouter is Lamping and Veach's jump consistent hash over the slots of
+// every known member, so a member going down does not shift the others. A
+// key whose slot is down jumps again with a new hash until it lands on a
+// member that is up. Keys only move between members that stay up when a
+// node is added or removed in the middle of the config.
+type jumpRouter struct {
+	members []string
+	slots   []string
+	up      map[string]bool
+}
+
+func newJumpRouter(members, slots []string) Router {
+	r := &jumpRouter{members: sorted(members), up: make(map[string]bool, len(members))}
+	for _, m := range members {
+		r.up[m] = true
+	}
+	known := make(map[string]bool, len(slots))
+	for _, s := range slots {
+		if !known[s] {
+			known[s] = true
+			r.slots = append(r.slots, s)
+		}
+	}
+	for _, m := range r.members {
+		if !known[m] {
+			r.slots = append(r.slots, m)
+		}
+	}
+	return r
+}
+
+func jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (r *jumpRouter) Get(key string) (string, error) {
+	res, err := r.GetN(key, 1)
+	if err != nil {
+		return "", err
+	}
+	return res[0], nil
+}
+
+// GetN jumps again with a new hash after each pick, skipping the slots of
+// members that are down or already picked. Members that are not reached
+// after many jumps follow in sorted order.
+func (r *jumpRouter) GetN(key string, n int) ([]string, error) {
+	if len(r.members) == 0 {
+		return nil, errEmptyRouter
+	}
+	var res []string
+	h := hash64(key)
+	for i := 0; len(res) < n && len(res) < len(r.members) && i < 32*len(r.slots); i++ {
+		if s := r.slots[jump(h, len(r.slots))]; r.up[s] && !picked(res, s) {
+			res = append(res, s)
+		}
+		h = hash64(key, strconv.Itoa(i))
+	}
+	for _, m := range r.members {
+		if len(res) == n {
+			break
+		}
+		if !picked(res, m) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+func picked(res []string, m string) bool {
+	for _, s := range res {
+		if s == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *jumpRouter) Members() []string {
+	return r.members
+}
+
+// rendezvousRouter gives the key to the member with the highest hash of the
+// member and key together.
+type rendezvousRouter struct {
+	members []string
+}
+
+func newRendezvousRouter(members, _ []string) Router {
+	return &rendezvousRouter{members: sorted(members)}
+}
+
+func (r *rendezvousRouter) Get(key string) (string, error) {
+	if len(r.members) == 0 {
+		return "", errEmptyRouter
+	}
+	var best string
+	var max uint64
+	for _, m := range r.members {
+		if h := hash64(m, key); best == "" || h > max {
+			best, max = m, h
+		}
+	}
+	return best, nil
+}
+
+func (r *rendezvousRouter) GetN(key string, n int) ([]string, error) {
+	if len(r.members) == 0 {
+		return nil, errEmptyRouter
+	}
+	scores := make(map[string]uint64, len(r.members))
+	res := append([]string{}, r.members...)
+	for _, m := range res {
+		scores[m] = hash64(m, key)
+	}
+	sort.Slice(res, func(i, j int) bool { return scores[res[i]] > scores[res[j]] })
+	if n < len(res) {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+func (r *rendezvousRouter) Members() []string {
+	return r.members
+}
+
+// maglevSize is the prime size of the maglev lookup table.
+const maglevSize = 65537
+
+// maglevRouter is Google's Maglev hashing: each member fills the lookup
+// table in its own permutation order so members get nearly equal shares and
+// few keys move when the members change.
+type maglevRouter struct {
+	members []string
+	table   []int
+}
+
+func newMaglevRouter(members, _ []string) Router {
+	r := &maglevRouter{members: sorted(members)}
+	if len(r.members) == 0 {
+		return r
+	}
+
+	offsets := make([]uint64, len(r.members))
+	skips := make([]uint64, len(r.members))
+	next := make([]uint64, len(r.members))
+	for i, m := range r.members {
+		offsets[i] = hash64("offset", m) % maglevSize
+		skips[i] = hash64("skip", m)%(maglevSize-1) + 1
+	}
+
+	r.table = make([]int, maglevSize)
+	for i := range r.table {
+		r.table[i] = -1
+	}
+	for filled := 0; ; {
+		for i := range r.members {
+			c := (offsets[i] + next[i]*skips[i]) % maglevSize
+			for r.table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % maglevSize
+			}
+			r.table[c] = i
+			next[i]++
+			filled++
+			if filled == maglevSize {
+				return r
+			}
+		}
+	}
+}
+
+func (r *maglevRouter) Get(key string) (string, error) {
+	if len(r.members) == 0 {
+		return "", errEmptyRouter
+	}
+	return r.members[r.table[hash64(key)%maglevSize]], nil
+}
+
+// GetN walks the lookup table from the key's slot collecting new members.
+func (r *maglevRouter) GetN(key string, n int) ([]string, error) {
+	if len(r.members) == 0 {
+		return nil, errEmptyRouter
+	}
+	if n > len(r.members) {
+		n = len(r.members)
+	}
+	seen := make(map[int]bool, n)
+	var res []string
+	for i := hash64(key) % maglevSize; len(res) < n; i = (i + 1) % maglevSize {
+		if m := r.table[i]; !seen[m] {
+			seen[m] = true
+			res = append(res, r.members[m])
+		}
+	}
+	return res, nil
+}
+
+func (r *maglevRouter) Members() []string {
+	return r.members
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func members(count int) []string {
+	m := make([]string, count)
+	for i := range m {
+		m[i] = fmt.Sprintf("10.0.0.%d:8125", i+10)
+	}
+	return m
+}
+
+func routerKinds(t *testing.T, f func(t *testing.T, kind string)) {
+	saved := replicas
+	defer func() { replicas = saved }()
+	replicas = 200
+	for kind := range routers {
+		f(t, kind)
+	}
+}
+
+func TestRouterBalance(t *testing.T) {
+	routerKinds(t, func(t *testing.T, kind string) {
+		r := newRouter(kind, members(5), members(5))
+		keys := sampleKeys(20000)
+		counts := make(map[string]int)
+		for _, key := range keys {
+			m, err := r.Get(key)
+			if err != nil {
+				t.Fatal(kind, "Get should not return an error", err)
+			}
+			counts[m]++
+		}
+		for _, m := range members(5) {
+			if share := float64(counts[m]) / float64(len(keys)); share < 0.15 || share > 0.25 {
+				t.Error("expected", kind, "to give", m, "about a fifth of the keys, but it got", share)
+			}
+		}
+	})
+}
+
+func TestRouterAdd(t *testing.T) {
+	routerKinds(t, func(t *testing.T, kind string) {
+		before := newRouter(kind, members(5), members(5))
+		after := newRouter(kind, members(6), members(6))
+		added := members(6)[5]
+
+		moved, stolen := 0, 0
+		keys := sampleKeys(20000)
+		for _, key := range keys {
+			a, _ := before.Get(key)
+			b, _ := after.Get(key)
+			if a != b {
+				moved++
+				if b != added {
+					stolen++
+				}
+			}
+		}
+		if share := float64(moved) / float64(len(keys)); share > 0.25 {
+			t.Error("expected", kind, "to move about a sixth of the keys when a member is added, but it moved", share)
+		}
+		// maglev trades a little disruption for its even table
+		if limit := len(keys) / 100; stolen > limit {
+			t.Error("expected", kind, "to move keys to the new member only, but", stolen, "moved between old members")
+		}
+	})
+}
+
+func TestRouterRemove(t *testing.T) {
+	routerKinds(t, func(t *testing.T, kind string) {
+		before := newRouter(kind, members(6), members(6))
+		after := newRouter(kind, members(5), members(6))
+		removed := members(6)[5]
+
+		disrupted := 0
+		for _, key := range sampleKeys(20000) {
+			a, _ := before.Get(key)
+			b, _ := after.Get(key)
+			if a != b && a != removed {
+				disrupted++
+			}
+		}
+		if disrupted > 200 {
+			t.Error("expected", kind, "to only move the keys of the removed member, but", disrupted, "other keys moved")
+		}
+	})
+}
+
+func TestRouterRemoveMiddle(t *testing.T) {
+	routerKinds(t, func(t *testing.T, kind string) {
+		all := members(6)
+		removed := all[2]
+		left := append(append([]string{}, all[:2]...), all[3:]...)
+		before := newRouter(kind, all, all)
+		after := newRouter(kind, left, all)
+
+		disrupted := 0
+		for _, key := range sampleKeys(20000) {
+			a, _ := before.Get(key)
+			b, _ := after.Get(key)
+			if a != b && a != removed {
+				disrupted++
+			}
+		}
+		if disrupted > 200 {
+			t.Error("expected", kind, "to only move the keys of a member removed from the middle, but", disrupted, "other keys moved")
+		}
+	})
+}
+
+func TestRouterGetN(t *testing.T) {
+	routerKinds(t, func(t *testing.T, kind string) {
+		r := newRouter(kind, members(5), members(5))
+		for _, key := range sampleKeys(100) {
+			owner, _ := r.Get(key)
+			res, err := r.GetN(key, 3)
+			if err != nil || len(res) != 3 {
+				t.Fatal("expected", kind, "to return 3 members", res, err)
+			}
+			if res[0] != owner {
+				t.Error("expected", kind, "GetN to start with the owner", owner, "but it returned", res)
+			}
+			if res[0] == res[1] || res[1] == res[2] || res[0] == res[2] {
+				t.Error("expected", kind, "GetN to return distinct members, but it returned", res)
+			}
+		}
+
+		if _, err := newRouter(kind, nil, nil).Get("statsd.metric.test"); err == nil {
+			t.Error("expected", kind, "to return an error without members")
+		}
+	})
+}
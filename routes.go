@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+)
+
+// routes is a snapshot of the nodes and the router built from the ones that
+// are up. A snapshot is never changed once it is published, so reading the
+// current one takes no lock and lookups always see a router that matches its
+// nodes. The ring router still takes its own read lock on each Get.
+type routes struct {
+	router  Router
+	nodes   map[string]*node
+	members map[string]*node
+}
+
+var table atomic.Value
+
+// replicas is the number of points each unit of node weight gets on the
+// CRC32 ring.
+var replicas = 1
+
+func init() {
+	table.Store(newRoutes(map[string]*node{}))
+}
+
+func newRoutes(nodes map[string]*node) *routes {
+	r := &routes{nodes: nodes, members: make(map[string]*node)}
+	var members, slots []string
+	for _, n := range inConfigOrder(nodes) {
+		// extra weight is added as more members so a node with a weight
+		// of one keeps the keys it always had
+		for i := 1; i <= n.weight(); i++ {
+			member := n.Name()
+			if i > 1 {
+				member = fmt.Sprintf("%s#%d", member, i)
+			}
+			slots = append(slots, member)
+			if n.up {
+				r.members[member] = n
+				members = append(members, member)
+			}
+		}
+	}
+	r.router = newRouter(hashing, members, slots)
+	return r
+}
+
+// inConfigOrder sorts the nodes by their position in the config.
+func inConfigOrder(nodes map[string]*node) []*node {
+	sorted := make([]*node, 0, len(nodes))
+	for _, n := range nodes {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].slot != sorted[j].slot {
+			return sorted[i].slot < sorted[j].slot
+		}
+		return sorted[i].Name() < sorted[j].Name()
+	})
+	return sorted
+}
+
+func currentRoutes() *routes {
+	return table.Load().(*routes)
+}
+
+// publish builds a new snapshot from the nodes and swaps it in. The caller
+// must hold membership.
+func publish(nodes map[string]*node) *routes {
+	r := newRoutes(nodes)
+	table.Store(r)
+	return r
+}
+
+// insert adds new nodes to the table and puts them in the ring.
+func insert(nodes ...*node) {
+	membership.Lock()
+	defer membership.Unlock()
+	current := currentRoutes().nodes
+	next := make(map[string]*node, len(current)+len(nodes))
+	for name, n := range current {
+		next[name] = n
+	}
+	for _, n := range nodes {
+		log.Println("adding node", n.Name())
+		n.up = true
+		n.damp.observed = true
+		next[n.Name()] = n
+	}
+	publish(next)
+}
+
+// known reports whether n is the node the table holds under its name. A
+// node dropped by a reload may still be held by a health check or stream,
+// and must not come back. The caller must hold membership.
+func (n *node) known() bool {
+	return currentRoutes().nodes[n.Name()] == n
+}
+
+// route finds the node that owns the metric name.
+func (r *routes) route(key []byte) (*node, error) {
+	if len(key) == 0 {
+		return nil, errMalformed
+	}
+
+	name, err := r.router.Get(string(key))
+	if err != nil {
+		return nil, errNoBackend
+	}
+	n, found := r.members[name]
+	if !found {
+		return nil, errUnknownNode
+	}
+	return n, nil
+}
+
+// lookup returns the node that owns the key followed by up to n of the
+// nodes that would own it next.
+func (r *routes) lookup(key string, n int) ([]*node, error) {
+	// weighted nodes have several members, so ask for all of them
+	names, err := r.router.GetN(key, len(r.members))
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*node
+	for _, name := range names {
+		m := r.members[name]
+		if !containsNode(nodes, m) {
+			nodes = append(nodes, m)
+		}
+		if len(nodes) > n {
+			break
+		}
+	}
+	return nodes, nil
+}
+
+func containsNode(nodes []*node, n *node) bool {
+	for _, m := range nodes {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+// allNodes returns every known node, whether or not it is in the ring.
+func allNodes() []*node {
+	current := currentRoutes().nodes
+	nodes := make([]*node, 0, len(current))
+	for _, n := range current {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
@@ -0,0 +1,98 @@
+package main
+
+import "testing"
+
+func share(r *routes, keys []string) map[string]float64 {
+	shares := make(map[string]float64)
+	for _, key := range keys {
+		n, err := r.route([]byte(key))
+		if err != nil {
+			continue
+		}
+		shares[n.Name()] += 1 / float64(len(keys))
+	}
+	return shares
+}
+
+func TestWeight(t *testing.T) {
+	saved := replicas
+	defer func() { replicas = saved }()
+	replicas = 100
+
+	nodes := map[string]*node{}
+	for i, weight := range []int{1, 1, 2} {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, Weight: weight, up: true}
+		nodes[n.Name()] = n
+	}
+	shares := share(newRoutes(nodes), sampleKeys(10000))
+	if s := shares["127.0.0.1:9102"]; s < 0.4 || s > 0.6 {
+		t.Error("expected the node with twice the weight to own about half the keys, but it owned", s)
+	}
+	if s := shares["127.0.0.1:9100"]; s < 0.15 || s > 0.35 {
+		t.Error("expected a node with the default weight to own about a quarter of the keys, but it owned", s)
+	}
+}
+
+func TestWeightOnlyMovesToNode(t *testing.T) {
+	nodes := map[string]*node{}
+	for i := 0; i < 3; i++ {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, up: true}
+		nodes[n.Name()] = n
+	}
+	before := newRoutes(nodes)
+	nodes["127.0.0.1:9101"].Weight = 3
+	after := newRoutes(nodes)
+
+	for _, key := range sampleKeys(1000) {
+		a, _ := before.route([]byte(key))
+		b, _ := after.route([]byte(key))
+		if a != b && b.Name() != "127.0.0.1:9101" {
+			t.Error("expected keys to only move to the node with more weight, but", key, "moved to", b.Name())
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	nodes := map[string]*node{}
+	for i, weight := range []int{3, 1, 1} {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, Weight: weight, up: true}
+		nodes[n.Name()] = n
+	}
+	r := newRoutes(nodes)
+	for _, key := range sampleKeys(100) {
+		owner, _ := r.route([]byte(key))
+		res, err := r.lookup(key, 2)
+		if err != nil || len(res) != 3 {
+			t.Fatal("expected the owner and 2 fallbacks", res, err)
+		}
+		if res[0] != owner {
+			t.Error("expected lookup to start with the owner", owner.Name(), "but it was", res[0].Name())
+		}
+		if res[0] == res[1] || res[1] == res[2] || res[0] == res[2] {
+			t.Error("expected lookup to return distinct nodes for", key)
+		}
+	}
+}
+
+func TestJumpKeepsSlots(t *testing.T) {
+	saved := hashing
+	defer func() { hashing = saved }()
+	hashing = "jump"
+
+	nodes := map[string]*node{}
+	for i := 0; i < 5; i++ {
+		n := &node{Host: "127.0.0.1", Port: 9100 + i, slot: i, up: true}
+		nodes[n.Name()] = n
+	}
+	before := newRoutes(nodes)
+	nodes["127.0.0.1:9102"].up = false
+	after := newRoutes(nodes)
+
+	for _, key := range sampleKeys(1000) {
+		a, _ := before.route([]byte(key))
+		b, _ := after.route([]byte(key))
+		if a != b && a.Name() != "127.0.0.1:9102" {
+			t.Error("expected only the keys of the node that went down to move, but", key, "moved from", a.Name())
+		}
+	}
+}
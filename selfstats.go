@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+type selfStatsConfig struct {
+	Interval duration
+	Prefix   string
+	Node     string
+}
+
+func (s *selfStatsConfig) setDefaults() {
+	if s.Prefix == "" {
+		s.Prefix = "statsd_proxy"
+	}
+}
+
+// reporter sends the proxy's own stats as statsd metrics, either to a
+// dedicated node or through the ring like any other metric.
+type reporter struct {
+	prefix string
+	conn   *net.UDPConn
+	dest   *net.UDPAddr
+	last   map[string]uint64
+}
+
+func startReporter(c selfStatsConfig, version string) error {
+	conn, err := makeConn(version, 0, "")
+	if err != nil {
+		return err
+	}
+	r := &reporter{prefix: c.Prefix, conn: conn, last: make(map[string]uint64)}
+	if c.Node != "" {
+		if r.dest, err = net.ResolveUDPAddr(version, c.Node); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	go func() {
+		for range time.Tick(c.Interval.Duration) {
+			r.send(r.lines(collect()))
+		}
+	}()
+	return nil
+}
+
+var unsafeName = strings.NewReplacer(".", "_", ":", "_", "/", "_", " ", "_")
+
+// lines turns the stats into statsd lines. Counters are sent as the change
+// since the last report and gauges as their current value.
+func (r *reporter) lines(stats []stat) []string {
+	var lines []string
+	for _, s := range stats {
+		name := r.prefix + "." + s.name
+		if s.label != "" {
+			name += "." + unsafeName.Replace(s.value)
+		}
+		if s.gauge {
+			lines = append(lines, fmt.Sprintf("%s:%d|g", name, s.count))
+			continue
+		}
+		// a counter that went backwards was reset, as when a reload adds a
+		// node back
+		delta := s.count
+		if last := r.last[name]; s.count >= last {
+			delta -= last
+		}
+		r.last[name] = s.count
+		if delta > 0 {
+			lines = append(lines, fmt.Sprintf("%s:%d|c", name, delta))
+		}
+	}
+	return lines
+}
+
+// send packs the lines for each destination into datagrams. Lines for nodes
+// reached over tcp or tls go through their stream.
+func (r *reporter) send(lines []string) {
+	routes := currentRoutes()
+	batches := make(map[string]*bytes.Buffer)
+	addrs := make(map[string]*net.UDPAddr)
+	for _, line := range lines {
+		addr := r.dest
+		if addr == nil {
+			n, err := routes.route(key([]byte(line)))
+			if err != nil {
+				continue
+			}
+			if n.stream != nil {
+				n.stream.write([]byte(line))
+				continue
+			}
+			addr = &n.Addr
+		}
+
+		b := batches[addr.String()]
+		if b == nil {
+			b = new(bytes.Buffer)
+			batches[addr.String()] = b
+			addrs[addr.String()] = addr
+		}
+		if b.Len() > 0 && b.Len()+1+len(line) > datagramSize {
+			r.write(b, addr)
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(line)
+	}
+	for name, b := range batches {
+		r.write(b, addrs[name])
+	}
+}
+
+func (r *reporter) write(b *bytes.Buffer, addr *net.UDPAddr) {
+	if _, err := r.conn.WriteToUDP(b.Bytes(), addr); err != nil {
+		log.Println("unable to report stats to", addr, err)
+	}
+	b.Reset()
+}
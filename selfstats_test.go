@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestReporterLines(t *testing.T) {
+	r := &reporter{prefix: "proxy", last: make(map[string]uint64)}
+	stats := []stat{
+		{name: "packets_received", count: 10},
+		{name: "node_up", gauge: true, label: "node", value: "127.0.0.1:8127", count: 1},
+	}
+	expected := []string{"proxy.packets_received:10|c", "proxy.node_up.127_0_0_1_8127:1|g"}
+	if lines := r.lines(stats); !reflect.DeepEqual(lines, expected) {
+		t.Error("expected", expected, "but the lines were", lines)
+	}
+
+	stats[0].count = 15
+	expected = []string{"proxy.packets_received:5|c", "proxy.node_up.127_0_0_1_8127:1|g"}
+	if lines := r.lines(stats); !reflect.DeepEqual(lines, expected) {
+		t.Error("expected counters to be sent as the change since the last report, but the lines were", lines)
+	}
+
+	expected = []string{"proxy.node_up.127_0_0_1_8127:1|g"}
+	if lines := r.lines(stats); !reflect.DeepEqual(lines, expected) {
+		t.Error("expected unchanged counters to be skipped, but the lines were", lines)
+	}
+	stats[0].count = 3
+	expected = []string{"proxy.packets_received:3|c", "proxy.node_up.127_0_0_1_8127:1|g"}
+	if lines := r.lines(stats); !reflect.DeepEqual(lines, expected) {
+		t.Error("expected a counter that was reset to be sent as its new value, but the lines were", lines)
+	}
+}
+
+func TestReporterSend(t *testing.T) {
+	setupTest(t)
+	conn, err := makeConn(c.UdpVersion, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal("should be able to create a connection", err)
+	}
+	defer conn.Close()
+
+	r := &reporter{prefix: "statsd", conn: conn}
+	r.send([]string{"statsd.metric.test:1|c", "statsd.metric.name:2|g"})
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+	readMetric("127.0.0.1:8127", "statsd.metric.name:2|g", t)
+
+	r.dest = serverMap["127.0.0.1:8131"].LocalAddr().(*net.UDPAddr)
+	r.send([]string{"statsd.metric.test:1|c", "statsd.metric.name:2|g"})
+	readMetric("127.0.0.1:8131", "statsd.metric.test:1|c\nstatsd.metric.name:2|g", t)
+}
+
+func TestReporterSendStream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	n := streamNode(t, "tcp", l.Addr(), testStream)
+	n.up = true
+
+	membership.Lock()
+	saved := currentRoutes().nodes
+	publish(map[string]*node{n.Name(): n})
+	membership.Unlock()
+	defer func() {
+		membership.Lock()
+		publish(saved)
+		membership.Unlock()
+	}()
+
+	r := &reporter{prefix: "statsd"}
+	r.send([]string{"statsd.metric.test:1|c"})
+	readLines(t, l, "statsd.metric.test:1|c")
+}
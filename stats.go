@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// counter is a monotonically increasing count that is safe to share between
+// goroutines.
+type counter uint64
+
+func (c *counter) Inc() {
+	c.Add(1)
+}
+
+func (c *counter) Add(n uint64) {
+	atomic.AddUint64((*uint64)(c), n)
+}
+
+func (c *counter) Value() uint64 {
+	return atomic.LoadUint64((*uint64)(c))
+}
+
+var (
+	packetsReceived  counter
+	bytesReceived    counter
+	truncatedPackets counter
+	droppedPackets   counter
+	linesReceived    counter
+	eventsReceived   counter
+	invalidLines     counter
+	quarantinedLines counter
+)
+
+// stat is one value of the proxy's internal metrics. Stats with the same
+// name differ by the value of their label.
+type stat struct {
+	name  string
+	help  string
+	gauge bool
+	label string
+	value string
+	count uint64
+}
+
+// collect reads every internal metric, grouped by name.
+func collect() []stat {
+	stats := []stat{
+		{name: "packets_received", help: "Datagrams read from clients.", count: packetsReceived.Value()},
+		{name: "bytes_received", help: "Bytes read from clients.", count: bytesReceived.Value()},
+		{name: "packets_truncated", help: "Datagrams larger than the read buffer.", count: truncatedPackets.Value()},
+		{name: "packets_dropped", help: "Datagrams dropped because the worker queue was full.", count: droppedPackets.Value()},
+		{name: "tcp_connections", help: "TCP connections accepted from clients.", count: tcpConnections.Value()},
+		{name: "tcp_lines_too_long", help: "Lines dropped because they were longer than the TCP MaxLineLength.", count: longLines.Value()},
+		{name: "lines_received", help: "Metric lines read from clients.", count: linesReceived.Value()},
+		{name: "events_received", help: "DogStatsD events and service checks read from clients.", count: eventsReceived.Value()},
+		{name: "lines_invalid", help: "Metric lines that failed to parse.", count: invalidLines.Value()},
+		{name: "lines_quarantined", help: "Invalid metric lines written to the quarantine file.", count: quarantinedLines.Value()},
+	}
+
+	var reasons []stat
+	for _, e := range lineErrors {
+		reasons = append(reasons, stat{name: "lines_dropped", help: "Metric lines that could not be routed.", label: "reason", value: e.reason, count: e.count.Value()})
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i].value < reasons[j].value })
+	stats = append(stats, reasons...)
+
+	r := currentRoutes()
+	nodes := allNodes()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name() < nodes[j].Name() })
+	membership.Lock()
+	up := make([]uint64, len(nodes))
+	for i, n := range nodes {
+		if n.up {
+			up[i] = 1
+		}
+	}
+	membership.Unlock()
+
+	stats = append(stats, stat{name: "ring_members", help: "Members of the hash ring.", gauge: true, count: uint64(len(r.router.Members()))})
+	for i, n := range nodes {
+		stats = append(stats, stat{name: "node_up", help: "Whether the node is in the hash ring.", gauge: true, label: "node", value: n.Name(), count: up[i]})
+	}
+	for _, n := range nodes {
+		stats = append(stats, stat{name: "node_lines", help: "Metric lines routed to the node.", label: "node", value: n.Name(), count: n.lines.Value()})
+	}
+	for _, n := range nodes {
+		stats = append(stats, stat{name: "node_write_errors", help: "Failed writes to the node.", label: "node", value: n.Name(), count: n.writeErrors.Value()})
+	}
+	for _, n := range nodes {
+		stats = append(stats, stat{name: "node_lines_dropped", help: "Metric lines dropped because the node's send buffer was full.", label: "node", value: n.Name(), count: n.dropped.Value()})
+	}
+	for _, n := range nodes {
+		stats = append(stats, stat{name: "node_removals", help: "Times the node was removed from the hash ring.", label: "node", value: n.Name(), count: n.removals.Value()})
+	}
+	return stats
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// streamConfig sets up the connections to nodes with a tcp or tls Protocol.
+type streamConfig struct {
+	Buffer             int
+	WriteTimeout       duration
+	Backoff            duration
+	MaxBackoff         duration
+	CAFile             string
+	InsecureSkipVerify bool
+
+	roots *x509.CertPool
+}
+
+// streaming is shared by every node that is reached over tcp or tls.
+var streaming streamConfig
+
+func (s *streamConfig) setDefaults() {
+	if s.Buffer == 0 {
+		s.Buffer = 1 << 20
+	}
+	if s.WriteTimeout.Duration == 0 {
+		s.WriteTimeout.Duration = 5 * time.Second
+	}
+	if s.Backoff.Duration == 0 {
+		s.Backoff.Duration = 100 * time.Millisecond
+	}
+	if s.MaxBackoff.Duration == 0 {
+		s.MaxBackoff.Duration = 30 * time.Second
+	}
+}
+
+// load reads the certificate authorities that tls nodes are verified with.
+func (s *streamConfig) load() error {
+	if s.CAFile == "" {
+		return nil
+	}
+	pem, err := os.ReadFile(s.CAFile)
+	if err != nil {
+		return err
+	}
+	s.roots = x509.NewCertPool()
+	if !s.roots.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", s.CAFile)
+	}
+	return nil
+}
+
+var (
+	errNotConnected = errors.New("not connected")
+	streamLog       = newRateLog(logInterval)
+)
+
+// stream buffers the lines for a node and writes them over one persistent
+// connection, reconnecting with exponential backoff when it fails. Lines
+// that do not fit in the buffer are dropped.
+type stream struct {
+	sync.Mutex
+	node    *node
+	addr    string
+	tls     *tls.Config
+	config  streamConfig
+	buf     []byte
+	spare   []byte
+	ready   chan bool
+	flushes chan chan error
+	quit    chan bool
+	closing sync.Once
+}
+
+func newStream(n *node, c streamConfig) *stream {
+	s := &stream{
+		node:    n,
+		addr:    net.JoinHostPort(n.Host, strconv.Itoa(n.Port)),
+		config:  c,
+		ready:   make(chan bool, 1),
+		flushes: make(chan chan error),
+		quit:    make(chan bool),
+	}
+	if n.Protocol == "tls" {
+		s.tls = &tls.Config{ServerName: n.Host, RootCAs: c.roots, InsecureSkipVerify: c.InsecureSkipVerify}
+	}
+	go s.run()
+	return s
+}
+
+// write adds the line to the buffer. The connection is only opened once
+// there is something to send.
+func (s *stream) write(line []byte) {
+	s.Lock()
+	if len(s.buf)+len(line)+1 > s.config.Buffer {
+		s.Unlock()
+		s.node.dropped.Inc()
+		return
+	}
+	s.buf = append(s.buf, line...)
+	s.buf = append(s.buf, '\n')
+	s.Unlock()
+
+	select {
+	case s.ready <- true:
+	default:
+	}
+}
+
+// Flush waits for the buffered lines to be written.
+func (s *stream) Flush() error {
+	done := make(chan error, 1)
+	select {
+	case s.flushes <- done:
+		return <-done
+	case <-s.quit:
+		return nil
+	}
+}
+
+// close writes what is buffered if the node is connected and stops the
+// stream.
+func (s *stream) close() {
+	s.closing.Do(func() { close(s.quit) })
+}
+
+func (s *stream) run() {
+	var conn net.Conn
+	backoff := s.config.Backoff.Duration
+	failed := false
+	for {
+		var done chan error
+		select {
+		case <-s.ready:
+		case done = <-s.flushes:
+		case <-s.quit:
+			if conn != nil {
+				s.flush(conn)
+				conn.Close()
+			}
+			return
+		}
+
+		var err error
+		if conn == nil && s.empty() {
+			if done != nil {
+				done <- nil
+			}
+			continue
+		}
+		if conn == nil {
+			conn, err = s.dial()
+		}
+		if err == nil {
+			err = s.flush(conn)
+		}
+		if done != nil {
+			done <- err
+		}
+		if err == nil {
+			if failed {
+				failed = false
+				s.node.observe(true)
+			}
+			backoff = s.config.Backoff.Duration
+			continue
+		}
+
+		streamLog.Printf("unable to write to node %s, retrying in %s: %s", s.node.Name(), backoff, err)
+		if conn != nil {
+			conn.Close()
+			conn = nil
+		}
+		// the stream adds the node back itself once it reconnects
+		failed = true
+		s.node.writeErrors.Inc()
+		s.node.observe(false)
+		if !s.wait(backoff) {
+			return
+		}
+		if backoff *= 2; backoff > s.config.MaxBackoff.Duration {
+			backoff = s.config.MaxBackoff.Duration
+		}
+		// try again with the lines that built up
+		select {
+		case s.ready <- true:
+		default:
+		}
+	}
+}
+
+// wait sleeps before reconnecting, failing flushes in the meantime. It
+// returns false if the stream is closed.
+func (s *stream) wait(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case done := <-s.flushes:
+			done <- errNotConnected
+		case <-s.quit:
+			return false
+		}
+	}
+}
+
+func (s *stream) empty() bool {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.buf) == 0
+}
+
+func (s *stream) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: s.config.WriteTimeout.Duration}
+	if s.tls != nil {
+		return tls.DialWithDialer(d, "tcp", s.addr, s.tls)
+	}
+	return d.Dial("tcp", s.addr)
+}
+
+// flush writes the buffer, swapping it for the spare so new lines can be
+// added while the write is in progress. The lines of a failed write are lost.
+func (s *stream) flush(conn net.Conn) error {
+	s.Lock()
+	buf := s.buf
+	s.buf = s.spare[:0]
+	s.Unlock()
+
+	s.spare = buf[:0]
+	if len(buf) == 0 {
+		return nil
+	}
+	conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout.Duration))
+	_, err := conn.Write(buf)
+	return err
+}
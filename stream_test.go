@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+var testStream = streamConfig{
+	Buffer:       1024,
+	WriteTimeout: duration{time.Second},
+	Backoff:      duration{10 * time.Millisecond},
+	MaxBackoff:   duration{40 * time.Millisecond},
+}
+
+func streamNode(t *testing.T, protocol string, addr net.Addr, c streamConfig) *node {
+	n := &node{Host: "127.0.0.1", Port: addr.(*net.TCPAddr).Port, Protocol: protocol}
+	n.stream = newStream(n, c)
+	t.Cleanup(n.stream.close)
+	return n
+}
+
+func readLines(t *testing.T, l net.Listener, lines ...string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal("expected the node to connect", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range lines {
+		got, err := r.ReadString('\n')
+		if err != nil || got != want+"\n" {
+			t.Error("expected", want, "but got", got, err)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	n := streamNode(t, "tcp", l.Addr(), testStream)
+	n.send(nil, []byte("statsd.metric.test:1|c"))
+	n.send(nil, []byte("statsd.metric.name:2|g"))
+	readLines(t, l, "statsd.metric.test:1|c", "statsd.metric.name:2|g")
+}
+
+func TestStreamReconnects(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr()
+	l.Close()
+
+	n := streamNode(t, "tcp", addr, testStream)
+	insert(n)
+	n.send(nil, []byte("statsd.metric.test:1|c"))
+	if err = n.stream.Flush(); err == nil {
+		t.Error("expected the flush to fail while the node is unreachable")
+	}
+	if n.writeErrors.Value() == 0 {
+		t.Error("expected the failed connection to be counted as a write error")
+	}
+
+	if l, err = net.Listen("tcp", addr.String()); err != nil {
+		t.Fatal("should be able to listen on the node port again", err)
+	}
+	defer l.Close()
+	readLines(t, l, "statsd.metric.test:1|c")
+
+	// the node is marked up once it reconnects
+	for i := 0; i < 100 && !n.isUp(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !n.isUp() {
+		t.Error("expected the node to be added back to the ring once it reconnected")
+	}
+
+	// take the node out of the routing table the other tests use
+	n.stream.close()
+	membership.Lock()
+	nodes := make(map[string]*node)
+	for name, m := range currentRoutes().nodes {
+		if m != n {
+			nodes[name] = m
+		}
+	}
+	publish(nodes)
+	membership.Unlock()
+}
+
+func TestStreamBuffer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr()
+	l.Close()
+
+	c := testStream
+	c.Buffer = 16
+	n := streamNode(t, "tcp", addr, c)
+	for i := 0; i < 3; i++ {
+		n.send(nil, []byte("a.b:1|c"))
+	}
+	if d := n.dropped.Value(); d != 1 {
+		t.Error("expected the line that did not fit in the buffer to be dropped, but", d, "were")
+	}
+}
+
+func TestStreamTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c := testStream
+	c.roots = x509.NewCertPool()
+	c.roots.AddCert(cert)
+	n := &node{Host: "localhost", Port: l.Addr().(*net.TCPAddr).Port, Protocol: "tls"}
+	n.stream = newStream(n, c)
+	defer n.stream.close()
+	n.send(nil, []byte("statsd.metric.test:1|c"))
+	readLines(t, l, "statsd.metric.test:1|c")
+}
+
+func TestStreamFlushIdle(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	n := streamNode(t, "tcp", l.Addr(), testStream)
+	if err = n.stream.Flush(); err != nil {
+		t.Error("expected flushing an idle stream to succeed", err)
+	}
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if conn, err := l.Accept(); err == nil {
+		conn.Close()
+		t.Error("expected an idle stream not to connect")
+	}
+}
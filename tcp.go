@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpConfig enables a listener for clients that send newline separated
+// lines over TCP.
+type tcpConfig struct {
+	Addr          string
+	IdleTimeout   duration
+	MaxLineLength int
+}
+
+func (t *tcpConfig) setDefaults(readBuffer int) {
+	if t.IdleTimeout.Duration == 0 {
+		t.IdleTimeout.Duration = time.Minute
+	}
+	if t.MaxLineLength == 0 {
+		t.MaxLineLength = readBuffer
+	}
+}
+
+var (
+	tcpConnections counter
+	longLines      counter
+	longLineLog    = newRateLog(logInterval)
+)
+
+// tcpServer reads lines from each connection into packets and queues them
+// on the same workers as the UDP readers. A full queue stops the reads
+// instead of dropping lines, leaving TCP to slow the client down.
+type tcpServer struct {
+	sync.Mutex
+	listener net.Listener
+	workers  *workers
+	config   tcpConfig
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+func listenTCP(c tcpConfig, w *workers) (*tcpServer, error) {
+	l, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &tcpServer{listener: l, workers: w, config: c, conns: make(map[net.Conn]bool)}
+	go t.serve()
+	return t, nil
+}
+
+func (t *tcpServer) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Println("unable to accept a tcp connection", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		t.Lock()
+		if t.conns == nil {
+			t.Unlock()
+			conn.Close()
+			return
+		}
+		t.conns[conn] = true
+		t.wg.Add(1)
+		t.Unlock()
+		tcpConnections.Inc()
+
+		go func() {
+			defer t.wg.Done()
+			t.read(conn)
+			t.Lock()
+			delete(t.conns, conn)
+			t.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// read queues the complete lines from the connection until it is closed or
+// stays idle for longer than the timeout. Lines longer than the maximum
+// are dropped.
+func (t *tcpServer) read(conn net.Conn) {
+	r := bufio.NewReaderSize(idleConn{conn, t.config.IdleTimeout.Duration}, t.config.MaxLineLength+1)
+	p := t.workers.get()
+	defer func() {
+		if p.Length > 0 {
+			t.workers.push(p)
+		} else {
+			t.workers.put(p)
+		}
+	}()
+
+	long := false
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			if !long {
+				longLines.Inc()
+				longLineLog.Printf("line from %s is longer than %d bytes, dropping it", conn.RemoteAddr(), t.config.MaxLineLength)
+			}
+			long = true
+			continue
+		}
+		if err != nil {
+			// a partial last line is dropped with the connection
+			return
+		}
+		if long {
+			long = false
+			continue
+		}
+
+		bytesReceived.Add(uint64(len(line)))
+		if p.Length+len(line) > len(p.Buffer) {
+			t.workers.push(p)
+			p = t.workers.get()
+		}
+		p.Length += copy(p.Buffer[p.Length:], line)
+
+		// hand over what has been read before waiting for more
+		if r.Buffered() == 0 {
+			t.workers.push(p)
+			p = t.workers.get()
+		}
+	}
+}
+
+// stop closes the listener and every connection and waits for the lines
+// already read to be queued.
+func (t *tcpServer) stop() {
+	t.listener.Close()
+	t.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.conns = nil
+	t.Unlock()
+	t.wg.Wait()
+}
+
+// idleConn sets the read deadline before each read so a connection is only
+// closed once it stops sending.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c idleConn) Read(b []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTCPServer(t *testing.T, idle time.Duration) (*server, net.Conn) {
+	setupTest(t)
+	sc := c
+	sc.Port = 0
+	sc.Host = "127.0.0.1"
+	sc.TCP = tcpConfig{Addr: "127.0.0.1:0", IdleTimeout: duration{idle}, MaxLineLength: 64}
+	s, err := startServer(&sc)
+	if err != nil {
+		t.Fatal("should be able to start the server", err)
+	}
+	conn, err := net.Dial("tcp", s.tcp.listener.Addr().String())
+	if err != nil {
+		t.Fatal("should be able to connect to the tcp listener", err)
+	}
+	return s, conn
+}
+
+func TestTCPLines(t *testing.T) {
+	s, conn := startTCPServer(t, time.Second)
+	defer s.stop(time.Second)
+	defer conn.Close()
+
+	conn.Write([]byte("statsd.metric.te"))
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte("st:1|c\nstatsd.metric.name:2|g\n"))
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+	readMetric("127.0.0.1:8127", "statsd.metric.name:2|g", t)
+}
+
+func TestTCPLongLine(t *testing.T) {
+	s, conn := startTCPServer(t, time.Second)
+	defer s.stop(time.Second)
+	defer conn.Close()
+
+	long := longLines.Value()
+	conn.Write([]byte("statsd.metric.name:" + strings.Repeat("1", 100) + "|c\nstatsd.metric.name:3|g\n"))
+	readMetric("127.0.0.1:8127", "statsd.metric.name:3|g", t)
+	if count := longLines.Value() - long; count != 1 {
+		t.Error("expected 1 line to be dropped for being too long, but there were", count)
+	}
+}
+
+func TestTCPIdleTimeout(t *testing.T) {
+	s, conn := startTCPServer(t, 20*time.Millisecond)
+	defer s.stop(time.Second)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Error("expected an idle connection to be closed by the proxy, but got", err)
+	}
+}
@@ -0,0 +1,30 @@
+// Prints the owners proxy.js gives the keys in proxyjs_test.go, in the form
+// of the golden maps there. proxy.js builds its ring like this, with a
+// weight of 100 for every node.
+//
+//   npm install hashring@3
+//   node testdata/proxyjs_golden.js
+var HashRing = require('hashring');
+
+console.log('// hashring ' + require('hashring/package.json').version);
+
+function owners(nodes, keys) {
+  var servers = {};
+  nodes.forEach(function (n) { servers[n] = 100; });
+  var ring = new HashRing(servers, 'md5');
+  keys.forEach(function (k) {
+    console.log('\t\t"' + k + '": "' + ring.get(k) + '",');
+  });
+  console.log();
+}
+
+owners(['127.0.0.1:8127', '127.0.0.1:8129', '127.0.0.1:8131'], [
+  'statsd.metric.test', 'statsd.metric.name', 'api.latency', 'api.requests.count',
+  'app.web01.cpu.user', 'app.web02.cpu.user', 'db.queries.slow', 'gorets',
+  'glork', 'gaugor', 'uniques', 'a'
+]);
+
+var seven = [], keys = [];
+for (var i = 0; i < 7; i++) seven.push('10.0.0.' + (i + 10) + ':8125');
+for (var j = 0; j < 12; j++) keys.push('app.host' + j + '.requests');
+owners(seven, keys);
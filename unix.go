@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// unixConfig enables a unix datagram socket for clients on the same host.
+type unixConfig struct {
+	Path string
+	Mode string
+}
+
+func (u *unixConfig) setDefaults() {
+	if u.Mode == "" {
+		u.Mode = "0666"
+	}
+}
+
+func (u unixConfig) mode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(u.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("unix socket mode %q is not an octal permission", u.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenUnix binds the socket, replacing one left behind by a proxy that
+// did not shut down cleanly, and sets its permissions.
+func listenUnix(c unixConfig) (*net.UnixConn, error) {
+	mode, err := c.mode()
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(c.Path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", c.Path)
+		}
+		if err = os.Remove(c.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: c.Path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(c.Path, mode); err != nil {
+		closeUnix(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// closeUnix closes the socket and removes its file.
+func closeUnix(conn *net.UnixConn) {
+	path := conn.LocalAddr().String()
+	conn.Close()
+	os.Remove(path)
+}
+
+func readUnix(conn *net.UnixConn, w *workers) error {
+	for {
+		p := w.get()
+		n, addr, err := conn.ReadFromUnix(p.Buffer)
+		if err != nil {
+			w.put(p)
+			return err
+		}
+		p.Length = n
+		received(p, addr)
+		w.queue(p)
+	}
+}
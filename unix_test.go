@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixListener(t *testing.T) {
+	setupTest(t)
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+
+	// a socket left behind by a proxy that was killed
+	stale, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal("should be able to create a stale socket", err)
+	}
+	stale.Close()
+
+	sc := c
+	sc.Port = 0
+	sc.Host = "127.0.0.1"
+	sc.Unix = unixConfig{Path: path, Mode: "0660"}
+	s, err := startServer(&sc)
+	if err != nil {
+		t.Fatal("should be able to replace the stale socket", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0660 {
+		t.Error("expected the socket to have mode 0660, but got", info, err)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal("should be able to connect to the socket", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("statsd.metric.test:1|c\nstatsd.metric.name:2|g"))
+	readMetric("127.0.0.1:8129", "statsd.metric.test:1|c", t)
+	readMetric("127.0.0.1:8127", "statsd.metric.name:2|g", t)
+
+	if err = s.stop(time.Second); err != nil {
+		t.Error("stop should drain the queue", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the socket file to be removed once the server stopped, but got", err)
+	}
+}
+
+func TestUnixListenerKeepsFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(unixConfig{Path: path, Mode: "0666"}); err == nil {
+		t.Error("expected a file that is not a socket to be left alone")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("expected the file to still exist", err)
+	}
+}
+
+func TestUnixMode(t *testing.T) {
+	for _, mode := range []string{"666", "rw", "01777"} {
+		if _, err := (unixConfig{Mode: mode}).mode(); (err == nil) != (mode == "666") {
+			t.Error("unexpected result parsing mode", mode, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// workers handles packets on a fixed number of goroutines and recycles the
+// packet buffers once they are forwarded.
+type workers struct {
+	packets chan *packet
+	buffers sync.Pool
+	block   bool
+	ioBatch int
+	wg      sync.WaitGroup
+}
+
+func newWorkers(conn *net.UDPConn, c *config) *workers {
+	w := &workers{
+		packets: make(chan *packet, c.QueueSize),
+		block:   c.Overflow == "block",
+		ioBatch: c.IOBatch,
+	}
+	// read one extra byte to detect packets larger than the buffer
+	size := c.ReadBuffer + 1
+	w.buffers.New = func() interface{} {
+		return &packet{Buffer: make([]byte, size)}
+	}
+	w.wg.Add(c.Workers)
+	for i := 0; i < c.Workers; i++ {
+		go w.run(conn)
+	}
+	return w
+}
+
+func (w *workers) get() *packet {
+	return w.buffers.Get().(*packet)
+}
+
+func (w *workers) put(p *packet) {
+	p.Length = 0
+	w.buffers.Put(p)
+}
+
+// queue hands the packet to a worker. When every worker is busy and the
+// queue is full the packet is dropped unless the overflow policy is block.
+func (w *workers) queue(p *packet) {
+	if w.block {
+		w.packets <- p
+		return
+	}
+	select {
+	case w.packets <- p:
+	default:
+		droppedPackets.Inc()
+		w.put(p)
+	}
+}
+
+// push hands the packet to a worker, waiting for room in the queue whatever
+// the overflow policy so a stream reader pushes back on its client.
+func (w *workers) push(p *packet) {
+	w.packets <- p
+}
+
+func (w *workers) run(conn *net.UDPConn) {
+	var out *mmsgWriter
+	if w.ioBatch > 0 {
+		out = newMmsgWriter(conn, w.ioBatch)
+	}
+	defer w.wg.Done()
+	for p := range w.packets {
+		p.handle(conn, out)
+		w.put(p)
+	}
+}
+
+// stop waits for the queued packets to be handled. Nothing may be queued
+// once it is called.
+func (w *workers) stop() {
+	close(w.packets)
+	w.wg.Wait()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueDrop(t *testing.T) {
+	w := &workers{packets: make(chan *packet, 1)}
+	w.buffers.New = func() interface{} {
+		return &packet{Buffer: make([]byte, 16)}
+	}
+	dropped := droppedPackets.Value()
+
+	w.queue(w.get())
+	if droppedPackets.Value() != dropped {
+		t.Error("expected the packet to be queued")
+	}
+	w.queue(w.get())
+	if droppedPackets.Value() != dropped+1 {
+		t.Error("expected the packet to be dropped when the queue is full")
+	}
+}
+
+func TestPushWaits(t *testing.T) {
+	w := &workers{packets: make(chan *packet, 1)}
+	w.push(&packet{})
+
+	done := make(chan bool)
+	go func() {
+		w.push(&packet{})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Error("expected push to wait for room in a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-w.packets
+	<-done
+}